@@ -0,0 +1,165 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Alphabet is a set of characters that captcha solutions are made of.
+//
+// Solutions are stored and passed to functions such as Verify and NewImage as
+// byte slices, where each byte is an index of a character in the alphabet.
+// For DigitAlphabet, indices are equal to digits, so solutions created by
+// RandomDigits can be used with it.
+type Alphabet struct {
+	chars string
+	// index maps characters to their indices plus one; zero means that
+	// the character is not in the alphabet.
+	index [256]byte
+	// lookalikes is true if characters that are not in the alphabet are
+	// replaced with similar looking ones when parsing solutions.
+	lookalikes bool
+}
+
+var (
+	// DigitAlphabet consists of digits 0-9. It is the default alphabet.
+	DigitAlphabet = mustAlphabet("0123456789")
+	// UnambiguousAlphabet consists of digits and uppercase Latin letters
+	// excluding 0, O, 1 and I, which are easy to confuse.
+	UnambiguousAlphabet = mustAlphabet("23456789ABCDEFGHJKLMNPQRSTUVWXYZ")
+)
+
+// NewAlphabet returns a new alphabet consisting of the given characters.
+// Characters must be digits or uppercase Latin letters, which have glyphs for
+// images, and must not repeat. The alphabet must contain at least two
+// characters.
+func NewAlphabet(chars string) (*Alphabet, error) {
+	if len(chars) < 2 {
+		return nil, errors.New("captcha: alphabet must contain at least two characters")
+	}
+	a := &Alphabet{chars: chars}
+	for i := 0; i < len(chars); i++ {
+		c := chars[i]
+		if !('0' <= c && c <= '9' || 'A' <= c && c <= 'Z') {
+			return nil, errors.New("captcha: no glyph for character " + strconv.QuoteRune(rune(c)) + " in alphabet")
+		}
+		if a.index[c] != 0 {
+			return nil, errors.New("captcha: duplicate character " + strconv.QuoteRune(rune(c)) + " in alphabet")
+		}
+		a.index[c] = byte(i + 1)
+	}
+	return a, nil
+}
+
+func mustAlphabet(chars string) *Alphabet {
+	a, err := NewAlphabet(chars)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// WithLookalikes returns a copy of the alphabet that, when parsing solutions
+// typed by users, replaces characters which are not in the alphabet with
+// similar looking characters that are, for example, O with 0 or 1 with I.
+func (a *Alphabet) WithLookalikes() *Alphabet {
+	b := *a
+	b.lookalikes = true
+	return &b
+}
+
+// String returns characters of the alphabet.
+func (a *Alphabet) String() string {
+	return a.chars
+}
+
+// Len returns the number of characters in the alphabet.
+func (a *Alphabet) Len() int {
+	return len(a.chars)
+}
+
+// Random returns a new random solution of the given length.
+func (a *Alphabet) Random(length int) []byte {
+	return randomBytesMod(length, byte(len(a.chars)))
+}
+
+// Format returns the solution as a string of characters. It panics if the
+// solution contains indices out of the alphabet's range.
+func (a *Alphabet) Format(solution []byte) string {
+	s := make([]byte, len(solution))
+	for i, n := range solution {
+		s[i] = a.chars[n]
+	}
+	return string(s)
+}
+
+// Parse converts a string typed by a user into a solution. It ignores spaces
+// and commas, and is case-insensitive. It returns false if the string is
+// empty or contains other characters that are not in the alphabet.
+func (a *Alphabet) Parse(s string) ([]byte, bool) {
+	if s == "" {
+		return nil, false
+	}
+	ns := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == ' ' || c == ',' {
+			continue
+		}
+		if 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		n := a.index[c]
+		if n == 0 && a.lookalikes {
+			for _, l := range lookalikes[c] {
+				if n = a.index[l]; n != 0 {
+					break
+				}
+			}
+		}
+		if n == 0 {
+			return nil, false
+		}
+		ns = append(ns, n-1)
+	}
+	return ns, true
+}
+
+// hasOnlyDigits returns true if all characters of the alphabet are digits.
+func (a *Alphabet) hasOnlyDigits() bool {
+	for i := 0; i < len(a.chars); i++ {
+		if a.chars[i] < '0' || a.chars[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// lookalikes maps characters to similar looking ones, in order of
+// preference.
+var lookalikes = [256]string{
+	'0': "ODQ",
+	'O': "0DQ",
+	'Q': "O0",
+	'D': "0O",
+	'1': "ILJT7",
+	'I': "1LJT",
+	'L': "1I",
+	'J': "1I",
+	'T': "71I",
+	'7': "T1",
+	'2': "Z",
+	'Z': "2",
+	'5': "S",
+	'S': "5",
+	'6': "G",
+	'G': "6",
+	'8': "B",
+	'B': "8",
+	'U': "V",
+	'V': "U",
+}
@@ -0,0 +1,92 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNewAlphabet(t *testing.T) {
+	for _, chars := range []string{"", "A", "AA", "AB-", "abc", "ABCA"} {
+		if _, err := NewAlphabet(chars); err == nil {
+			t.Errorf("%q: expected error", chars)
+		}
+	}
+	a, err := NewAlphabet("XYZ123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Len() != 6 || a.String() != "XYZ123" {
+		t.Errorf("bad alphabet: %d %q", a.Len(), a)
+	}
+	for i := 0; i < 10; i++ {
+		for _, n := range a.Random(20) {
+			if int(n) >= a.Len() {
+				t.Fatalf("random index %d out of range", n)
+			}
+		}
+	}
+}
+
+func TestAlphabetParse(t *testing.T) {
+	tests := []struct {
+		a      *Alphabet
+		s      string
+		result string
+	}{
+		{DigitAlphabet, "123456", "123456"},
+		{DigitAlphabet, "1 2,3", "123"},
+		{DigitAlphabet, "12a", ""},
+		{DigitAlphabet, "", ""},
+		{DigitAlphabet, "1O", ""},
+		{DigitAlphabet.WithLookalikes(), "1O lI", "1011"},
+		{UnambiguousAlphabet, "abc23", "ABC23"},
+		{UnambiguousAlphabet, "A0", ""},
+		{UnambiguousAlphabet.WithLookalikes(), "A0 1", "ADL"},
+		{UnambiguousAlphabet.WithLookalikes(), "o", "D"},
+	}
+	for i, test := range tests {
+		ns, ok := test.a.Parse(test.s)
+		if test.result == "" {
+			if ok {
+				t.Errorf("%d: %q parsed as %v", i, test.s, ns)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%d: %q not parsed", i, test.s)
+			continue
+		}
+		if s := test.a.Format(ns); s != test.result {
+			t.Errorf("%d: %q parsed as %q, expected %q", i, test.s, s, test.result)
+		}
+	}
+	if ns, _ := DigitAlphabet.Parse("0123456789"); !bytes.Equal(ns, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Errorf("digits are not equal to their indices: %v", ns)
+	}
+}
+
+func TestManagerAlphabet(t *testing.T) {
+	m := NewManager(Config{Alphabet: UnambiguousAlphabet})
+	id := m.New()
+	s := m.alphabet.Format(getDigits(m, id))
+	if !m.VerifyString(id, string(bytes.ToLower([]byte(s)))) {
+		t.Errorf("lowercase solution not verified")
+	}
+	id = m.New()
+	if err := m.WriteImage(ioutil.Discard, id, StdWidth, StdHeight); err != nil {
+		t.Errorf("WriteImage: %v", err)
+	}
+	if err := m.WriteAudioContext(context.Background(), ioutil.Discard, id, ""); err != ErrNoAudio {
+		t.Errorf("WriteAudio: expected ErrNoAudio, got %v", err)
+	}
+	token := m.NewToken()
+	if !m.VerifyTokenString(token, m.alphabet.Format(tokenDigits(t, m, token))) {
+		t.Errorf("token not verified")
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"io"
+	"math"
+)
+
+const (
+	// Number of frames in animated image.
+	animationFrames = 8
+	// Delay between frames in 100ths of a second.
+	animationDelay = 15
+	// Each dot of digits is left out of a frame with probability
+	// 1/animationDotDrop.
+	animationDotDrop = 5
+)
+
+// AnimatedImage is an animated captcha image. All frames show the same
+// digits, but each frame leaves out different dots of them and moves them
+// slightly, while noise circles and the strike-through line move between
+// frames, so that digits are harder to recognize in any single frame.
+type AnimatedImage struct {
+	*gif.GIF
+}
+
+// NewAnimatedImage returns a new animated captcha image of the given width
+// and height with the given digits. See NewImage for details.
+func NewAnimatedImage(id string, digits []byte, width, height int) *AnimatedImage {
+	return defaultManager.NewAnimatedImage(id, digits, width, height)
+}
+
+// newAnimatedImage returns a new animated captcha image with the given
+// characters, drawn with the given options and PRNG initialized from the
+// given seed.
+func newAnimatedImage(seed [16]byte, chars []byte, width, height int, opts ImageOptions) *AnimatedImage {
+	m := &Image{opts: opts}
+
+	// Initialize PRNG.
+	m.rng.Seed(seed)
+
+	m.Paletted = image.NewPaletted(image.Rect(0, 0, width, height), m.getRandomPalette())
+	var glyphs []animatedGlyph
+	var base *image.Paletted
+	if opts.Renderer != nil {
+		m.drawChars(chars)
+		base = m.Paletted
+	} else {
+		glyphs = m.placeGlyphs(chars)
+	}
+	rect, palette := m.Rect, m.Palette
+	lines := make([]strikeLine, opts.StrikeLines)
+	for i := range lines {
+		lines[i] = m.randomStrikeLine()
+	}
+	amplitude, period := m.rng.Float(opts.MinDistortion, opts.MaxDistortion), m.rng.Float(100, 200)
+
+	a := &AnimatedImage{&gif.GIF{
+		Image:    make([]*image.Paletted, animationFrames),
+		Delay:    make([]int, animationFrames),
+		Disposal: make([]byte, animationFrames),
+	}}
+	for i := range a.Image {
+		m.Paletted = image.NewPaletted(rect, palette)
+		// Draw digits with a different subset of dots and offset.
+		r := maxInt(m.dotSize/2, 1)
+		if base != nil {
+			m.copyDots(base, m.rng.Int(-r, r), m.rng.Int(-r, r))
+		}
+		for _, g := range glyphs {
+			m.drawDots(g.font, g.glyph, g.x+m.rng.Int(-r, r), g.y+m.rng.Int(-r, r), g.skew, animationDotDrop)
+		}
+		// Move lines along themselves by one period during the
+		// animation, and up and down by half of their amplitude.
+		phase := float64(i) / animationFrames
+		for _, l := range lines {
+			dy := int(l.amplitude / 2 * math.Sin(2*math.Pi*phase))
+			m.drawStrikeLine(l, l.period*phase, dy)
+		}
+		m.distort(amplitude, period)
+		m.fillWithCircles(opts.Circles, m.maxCircleRadius())
+		a.Image[i] = m.Paletted
+		a.Delay[i] = animationDelay
+		a.Disposal[i] = gif.DisposalBackground
+	}
+	return a
+}
+
+// animatedGlyph is a glyph placed on an animated image.
+type animatedGlyph struct {
+	font  *Font
+	glyph []byte
+	x, y  int
+	skew  float64
+}
+
+// placeGlyphs returns glyphs of the characters placed at a random position
+// inside the image, as drawChars does, without drawing them.
+func (m *Image) placeGlyphs(chars []byte) []animatedGlyph {
+	width := m.Bounds().Max.X
+	height := m.Bounds().Max.Y
+	fonts := m.chooseFonts(chars)
+	m.calculateSizes(width, height, len(chars))
+	x, y := m.charsPosition(width, height, len(chars))
+	glyphs := make([]animatedGlyph, len(chars))
+	for i, c := range chars {
+		g := animatedGlyph{font: fonts[i], glyph: fonts[i].glyph(c)}
+		g.x, g.y, g.skew = m.placeGlyph(fonts[i], x, y)
+		glyphs[i] = g
+		x += m.numWidth + m.dotSize
+	}
+	return glyphs
+}
+
+// copyDots copies characters drawn on src by a CharRenderer, moved by dx and
+// dy pixels, leaving out random squares of the dot size.
+func (m *Image) copyDots(src *image.Paletted, dx, dy int) {
+	size := maxInt(m.dotSize, 1)
+	b := src.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y += size {
+		for x := b.Min.X; x < b.Max.X; x += size {
+			if m.rng.Intn(animationDotDrop) == 0 {
+				continue
+			}
+			for yo := y; yo < minInt(y+size, b.Max.Y); yo++ {
+				for xo := x; xo < minInt(x+size, b.Max.X); xo++ {
+					if src.ColorIndexAt(xo, yo) == 1 {
+						m.SetColorIndex(xo+dx, yo+dy, 1)
+					}
+				}
+			}
+		}
+	}
+}
+
+// WriteTo writes captcha image in animated GIF format into the given writer.
+func (a *AnimatedImage) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, a.GIF); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
+
+// WriteGIF writes captcha image in GIF format into the given writer.
+func (m *Image) WriteGIF(w io.Writer) error {
+	return gif.Encode(w, m.Paletted, nil)
+}
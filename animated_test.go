@@ -0,0 +1,100 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnimatedImage(t *testing.T) {
+	m := NewManager(Config{})
+	id := m.New()
+	var b1, b2 bytes.Buffer
+	if err := m.WriteAnimatedImage(&b1, id, StdWidth, StdHeight); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteAnimatedImage(&b2, id, StdWidth, StdHeight); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b1.Bytes(), b2.Bytes()) {
+		t.Errorf("animated images of the same captcha are different")
+	}
+	g, err := gif.DecodeAll(&b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != animationFrames {
+		t.Fatalf("expected %d frames, got %d", animationFrames, len(g.Image))
+	}
+	for i := 1; i < len(g.Image); i++ {
+		if bytes.Equal(g.Image[0].Pix, g.Image[i].Pix) {
+			t.Errorf("frame %d is equal to the first frame", i)
+		}
+	}
+}
+
+// boxRenderer is a CharRenderer that draws characters as filled boxes.
+type boxRenderer struct{}
+
+func (boxRenderer) DrawChars(m *image.Paletted, chars []byte, rng *rand.Rand) {
+	for x := 20; x < m.Rect.Dx()-20; x++ {
+		for y := 20; y < m.Rect.Dy()-20; y++ {
+			m.SetColorIndex(x, y, 1)
+		}
+	}
+}
+
+func TestAnimatedImageDigits(t *testing.T) {
+	// Without noise, frames must still differ in how digits are drawn.
+	opts := DefaultImage
+	opts.Circles = 0
+	opts.StrikeLines = 0
+	for _, r := range []CharRenderer{nil, boxRenderer{}} {
+		opts.Renderer = r
+		a := newAnimatedImage([16]byte{1}, []byte("123456"), StdWidth, StdHeight, opts)
+		for i := 1; i < len(a.Image); i++ {
+			if bytes.Equal(a.Image[0].Pix, a.Image[i].Pix) {
+				t.Errorf("renderer %v: frame %d has the same digits as the first frame", r, i)
+			}
+		}
+	}
+}
+
+func TestImageWriteGIF(t *testing.T) {
+	img := NewImage("id", RandomDigits(DefaultLen), StdWidth, StdHeight)
+	var b bytes.Buffer
+	if err := img.WriteGIF(&b); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Bounds() != img.Bounds() {
+		t.Errorf("decoded GIF has bounds %v, expected %v", g.Bounds(), img.Bounds())
+	}
+}
+
+func TestServerAnimatedImage(t *testing.T) {
+	m := NewManager(Config{})
+	id := m.New()
+	w := httptest.NewRecorder()
+	m.Server().ServeHTTP(w, httptest.NewRequest("GET", "/captcha/"+id+".gif", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/gif" {
+		t.Errorf("expected image/gif content type, got %q", ct)
+	}
+	if _, err := gif.DecodeAll(w.Body); err != nil {
+		t.Errorf("served bad GIF: %v", err)
+	}
+}
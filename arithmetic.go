@@ -0,0 +1,161 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// Arithmetic challenges show an expression, such as "7 + 12 =", instead of a
+// random string, and are solved by typing the answer. They are stored in the
+// same way as other solutions: the expression is written with digits 0-9 and
+// operator codes, followed by the answer, for example:
+//
+//	7, opPlus, 1, 2, opEquals, 1, 9
+//
+// Only the part after opEquals is compared with solutions, and only the part
+// before it (including opEquals) is rendered.
+
+// Operator codes. They are out of range of alphabet indices.
+const (
+	opPlus byte = 0xF0 + iota
+	opMinus
+	opTimes
+	opEquals
+)
+
+// opChars are characters of glyphs of operators, indexed by code - opPlus.
+var opChars = [...]byte{'+', '-', '*', '='}
+
+// Arithmetic describes arithmetic challenges created by a manager.
+type Arithmetic struct {
+	// MinAnswer and MaxAnswer are the range of answers, inclusive.
+	// MaxAnswer defaults to 20 and must not exceed MaxArithmeticAnswer.
+	MinAnswer int
+	MaxAnswer int
+	// Operators are the operators used in expressions: any of "+", "-" and
+	// "*". Defaults to "+-".
+	Operators string
+}
+
+var (
+	errArithmeticAlphabet = errors.New("captcha: arithmetic challenges require DigitAlphabet")
+	errArithmeticAudio    = errors.New("captcha: arithmetic challenges require sounds of operators")
+)
+
+// MaxArithmeticAnswer is the maximum answer of arithmetic challenges.
+const MaxArithmeticAnswer = 9999
+
+// withDefaults returns a copy of arithmetic settings with defaults filled in,
+// or an error if they are invalid.
+func (a Arithmetic) withDefaults() (Arithmetic, error) {
+	if a.MaxAnswer == 0 {
+		a.MaxAnswer = 20
+	}
+	if a.Operators == "" {
+		a.Operators = "+-"
+	}
+	if a.MinAnswer < 0 || a.MinAnswer > a.MaxAnswer || a.MaxAnswer > MaxArithmeticAnswer {
+		return a, errors.New("captcha: bad range of arithmetic answers")
+	}
+	for i := 0; i < len(a.Operators); i++ {
+		switch a.Operators[i] {
+		case '+', '-', '*':
+		default:
+			return a, errors.New("captcha: bad arithmetic operator " + strconv.QuoteRune(rune(a.Operators[i])))
+		}
+	}
+	return a, nil
+}
+
+// randomInt returns a uniformly distributed random number in range [0, n).
+func randomInt(n int) int {
+	// Reject values above the largest multiple of n to avoid bias.
+	limit := 1<<32 - (1<<32)%uint64(n)
+	for {
+		r := uint64(binary.BigEndian.Uint32(randomBytes(4)))
+		if r < limit {
+			return int(r % uint64(n))
+		}
+	}
+}
+
+// newChallenge returns a new random arithmetic challenge. The answer is
+// picked first, and then the operands that produce it.
+func (a Arithmetic) newChallenge() []byte {
+	answer := a.MinAnswer + randomInt(a.MaxAnswer-a.MinAnswer+1)
+	var x, y int
+	var op byte
+	switch a.Operators[randomInt(len(a.Operators))] {
+	case '+':
+		op = opPlus
+		x = randomInt(answer + 1)
+		y = answer - x
+	case '-':
+		op = opMinus
+		y = randomInt(a.MaxAnswer - answer + 1)
+		x = answer + y
+	case '*':
+		op = opTimes
+		x, y = factors(answer)
+	}
+	b := appendNumber(nil, x)
+	b = append(b, op)
+	b = appendNumber(b, y)
+	b = append(b, opEquals)
+	return appendNumber(b, answer)
+}
+
+// factors returns two random numbers whose product is n, avoiding 1 if
+// possible.
+func factors(n int) (x, y int) {
+	if n == 0 {
+		x, y = 0, 1+randomInt(9)
+		if randomInt(2) == 0 {
+			x, y = y, x
+		}
+		return
+	}
+	var pairs [][2]int
+	for x := 2; x*x <= n; x++ {
+		if n%x == 0 {
+			pairs = append(pairs, [2]int{x, n / x}, [2]int{n / x, x})
+		}
+	}
+	if len(pairs) == 0 {
+		pairs = [][2]int{{1, n}, {n, 1}}
+	}
+	p := pairs[randomInt(len(pairs))]
+	return p[0], p[1]
+}
+
+// appendNumber appends decimal digits of n to b.
+func appendNumber(b []byte, n int) []byte {
+	for _, c := range strconv.Itoa(n) {
+		b = append(b, byte(c-'0'))
+	}
+	return b
+}
+
+// splitChallenge returns the expression (including opEquals) and the answer
+// of the arithmetic challenge. For other solutions, the expression is nil and
+// the answer is the solution itself.
+func splitChallenge(b []byte) (expr, answer []byte) {
+	for i, c := range b {
+		if c == opEquals {
+			return b[:i+1], b[i+1:]
+		}
+	}
+	return nil, b
+}
+
+// answerOf returns the answer of the arithmetic challenge, or the solution
+// itself if it's not a challenge.
+func answerOf(b []byte) []byte {
+	_, answer := splitChallenge(b)
+	return answer
+}
@@ -0,0 +1,151 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"context"
+	"io/ioutil"
+	"strconv"
+	"testing"
+)
+
+// evalChallenge evaluates the expression of the challenge and returns its
+// value and the answer.
+func evalChallenge(t *testing.T, b []byte) (value, answer int) {
+	expr, ans := splitChallenge(b)
+	if expr == nil {
+		t.Fatalf("not a challenge: %v", b)
+	}
+	number := func(b []byte) int {
+		n := 0
+		for _, d := range b {
+			if d > 9 {
+				t.Fatalf("bad digit in challenge %v", b)
+			}
+			n = n*10 + int(d)
+		}
+		return n
+	}
+	for i, c := range expr {
+		if c < opPlus {
+			continue
+		}
+		x, y := number(expr[:i]), number(expr[i+1:len(expr)-1])
+		switch c {
+		case opPlus:
+			value = x + y
+		case opMinus:
+			value = x - y
+		case opTimes:
+			value = x * y
+		default:
+			t.Fatalf("bad operator in challenge %v", b)
+		}
+		break
+	}
+	return value, number(ans)
+}
+
+func TestArithmeticChallenge(t *testing.T) {
+	a, err := Arithmetic{MinAnswer: 5, MaxAnswer: 30, Operators: "+-*"}.withDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		b := a.newChallenge()
+		value, answer := evalChallenge(t, b)
+		if value != answer {
+			t.Fatalf("%v: expression value %d != answer %d", b, value, answer)
+		}
+		if answer < a.MinAnswer || answer > a.MaxAnswer {
+			t.Fatalf("%v: answer %d out of range", b, answer)
+		}
+	}
+	for _, bad := range []Arithmetic{
+		{MinAnswer: -1},
+		{MinAnswer: 30, MaxAnswer: 10},
+		{MaxAnswer: MaxArithmeticAnswer + 1},
+		{Operators: "+/"},
+	} {
+		if _, err := bad.withDefaults(); err == nil {
+			t.Errorf("%v: expected error", bad)
+		}
+	}
+}
+
+func TestFactors(t *testing.T) {
+	for n := 0; n <= 100; n++ {
+		x, y := factors(n)
+		if x*y != n {
+			t.Errorf("factors(%d) = %d, %d", n, x, y)
+		}
+	}
+}
+
+// registerTestOperators registers sounds of operators for English and
+// returns a function restoring the built-in voice.
+func registerTestOperators(t *testing.T) (restore func()) {
+	en := getVoice("en")
+	ops := [4][]byte{testWAV(0.3, 8000, 8), testWAV(0.3, 8000, 8), testWAV(0.3, 8000, 8), testWAV(0.3, 8000, 8)}
+	if err := RegisterOperators("en", ops); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		voicesMu.Lock()
+		voices["en"] = en
+		voicesMu.Unlock()
+	}
+}
+
+func TestManagerArithmetic(t *testing.T) {
+	defer registerTestOperators(t)()
+	m := NewManager(Config{Arithmetic: Arithmetic{Operators: "*"}})
+	id := m.NewArithmetic()
+	b := getDigits(m, id)
+	_, answer := evalChallenge(t, b)
+	if !m.VerifyString(id, strconv.Itoa(answer)) {
+		t.Errorf("answer not verified")
+	}
+
+	id = m.NewArithmetic()
+	b = getDigits(m, id)
+	if m.Verify(id, b) {
+		t.Errorf("challenge verified with the whole expression")
+	}
+
+	id = m.NewArithmetic()
+	if err := m.WriteImage(ioutil.Discard, id, StdWidth, StdHeight); err != nil {
+		t.Errorf("WriteImage: %v", err)
+	}
+	if chars := string(m.renderedChars(getDigits(m, id))); chars[len(chars)-1] != '=' {
+		t.Errorf("rendered %q, expected expression", chars)
+	}
+	m.Reload(id)
+	if expr, _ := splitChallenge(getDigits(m, id)); expr == nil {
+		t.Errorf("reloaded challenge is not a challenge")
+	}
+
+	if _, err := NewManager(Config{Alphabet: UnambiguousAlphabet}).NewWithOptions(context.Background(), Options{Arithmetic: true}); err == nil {
+		t.Errorf("expected error creating challenge with letters alphabet")
+	}
+}
+
+func TestArithmeticAudio(t *testing.T) {
+	m := NewManager(Config{})
+	// Built-in voices have no operator sounds.
+	if _, err := m.NewWithOptions(context.Background(), Options{Arithmetic: true}); err == nil {
+		t.Errorf("expected error creating challenge without operator sounds")
+	}
+	defer registerTestOperators(t)()
+	id := m.NewArithmetic()
+	if err := m.WriteAudio(ioutil.Discard, id, ""); err != nil {
+		t.Errorf("WriteAudio: %v", err)
+	}
+	// Languages without operator sounds fall back to the manager's one.
+	if err := m.WriteAudio(ioutil.Discard, id, "ja"); err != nil {
+		t.Errorf("WriteAudio: %v", err)
+	}
+	m.NewAudio(id, getDigits(m, id), "ja")
+}
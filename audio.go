@@ -5,228 +5,407 @@
 package captcha
 
 import (
-	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
 	"math"
 )
 
-const sampleRate = 8000 // Hz
+// sampleRate is the rate of samples of registered sounds, Hz. Audio is
+// rendered at its output sample rate, to which sounds are resampled.
+const sampleRate = 22050
 
-var endingBeepSound []byte
+// AudioOptions describe the format of audio captchas and how voices are used.
+type AudioOptions struct {
+	// SampleRate is the sample rate of encoded audio in Hz, from 8000 to
+	// 48000. Common values are 8000, 16000 and 22050.
+	SampleRate int
+	// BitDepth is the number of bits per sample: 8 for unsigned 8-bit or
+	// 16 for signed 16-bit PCM.
+	BitDepth int
+	// MixSpeakers is true if each digit is pronounced by a random speaker
+	// of the language. Otherwise, one random speaker pronounces all digits
+	// of a captcha. See AddSpeaker.
+	MixSpeakers bool
+}
+
+// Audio formats.
+var (
+	// DefaultAudio is 8 kHz unsigned 8-bit audio, as produced by
+	// earlier versions of the package.
+	DefaultAudio = AudioOptions{SampleRate: 8000, BitDepth: 8}
+	// WidebandAudio is 16 kHz signed 16-bit audio.
+	WidebandAudio = AudioOptions{SampleRate: 16000, BitDepth: 16}
+	// HighQualityAudio is 22.05 kHz signed 16-bit audio.
+	HighQualityAudio = AudioOptions{SampleRate: 22050, BitDepth: 16}
+)
 
-func init() {
-	endingBeepSound = changeSpeed(beepSound, 1.4)
+// validate returns an error if the options are invalid.
+func (o *AudioOptions) validate() error {
+	switch {
+	case o.SampleRate < 8000 || o.SampleRate > 48000:
+		return errors.New("captcha: audio sample rate must be in range [8000, 48000]")
+	case o.BitDepth != 8 && o.BitDepth != 16:
+		return errors.New("captcha: audio bit depth must be 8 or 16")
+	}
+	return nil
 }
 
+// Audio is an audio captcha. Its samples are not stored, but rendered in
+// chunks when it is written or read, so memory used by it doesn't depend on
+// the duration.
 type Audio struct {
-	body        *bytes.Buffer
-	digitSounds [][]byte
-	rng         siprng
+	opts           AudioOptions
+	length         int           // number of samples
+	noise          siprng        // generator of background noise
+	noiseStart     int           // position of background noise
+	noiseLen       int           // length of background noise
+	sounds         []placedSound // sounds mixed in order
+	speakers       []*speaker
+	operatorSounds [][][]int16
+	rng            siprng
+}
+
+// placedSound is a sound placed at a position of audio with changed speed
+// and level. Its samples are computed when audio is rendered.
+type placedSound struct {
+	src      []int16
+	pos      int     // position in audio
+	n        int     // number of samples
+	step     float64 // distance between samples in source samples
+	level    float64
+	reversed bool
+}
+
+// newPlacedSound returns a sound made longer by the given speed factor.
+func newPlacedSound(src []int16, pos int, speed, level float64) placedSound {
+	s := placedSound{src: src, pos: pos, n: len(src), step: 1, level: level}
+	if speed != 1 {
+		s.n = int(float64(len(src)) * speed)
+		s.step = 1 / speed
+	}
+	return s
+}
+
+// mix mixes samples of the sound starting from i0 into dst.
+func (s *placedSound) mix(dst []int16, i0 int) {
+	for i := range dst {
+		dst[i] = mixSample(dst[i], s.scaled(s.at(i0+i)))
+	}
+}
+
+// at returns the sample at the given position. If speed is changed, it is
+// linearly interpolated between source samples: changed sounds are only
+// used as background noise, which doesn't need better interpolation.
+func (s *placedSound) at(i int) int16 {
+	if s.step == 1 {
+		return s.sample(i)
+	}
+	p := float64(i) * s.step
+	k := int(p)
+	if k >= len(s.src)-1 {
+		return s.sample(len(s.src) - 1)
+	}
+	v0, v1 := float64(s.sample(k)), float64(s.sample(k+1))
+	return int16(v0 + (v1-v0)*(p-float64(k)))
+}
+
+// scaled returns the sample multiplied by the level of the sound.
+func (s *placedSound) scaled(v int16) int16 {
+	return clampSample(int(float64(v) * s.level))
+}
+
+// sample returns the source sample, reversed if needed.
+func (s *placedSound) sample(k int) int16 {
+	if s.reversed {
+		k = len(s.src) - 1 - k
+	}
+	return s.src[k]
 }
 
 // NewAudio returns a new audio captcha with the given digits, where each digit
 // must be in range 0-9. Digits are pronounced in the given language. If there
 // are no sounds for the given language, English is used.
 //
-// Possible values for lang are "en", "ja", "ru", "zh", "pt".
+// Built-in languages are "en", "ja", "ru", "zh", "pt". Other languages can
+// be added with RegisterVoice.
 func NewAudio(id string, digits []byte, lang string) *Audio {
-	a := new(Audio)
+	return defaultManager.NewAudio(id, digits, lang)
+}
+
+// NewAudioWithOptions is like NewAudio, but encodes audio in the given
+// format, such as DefaultAudio or HighQualityAudio. It panics if options are
+// invalid.
+func NewAudioWithOptions(id string, digits []byte, lang string, opts AudioOptions) *Audio {
+	return defaultManager.NewAudioWithOptions(id, digits, lang, opts)
+}
+
+// hasOperatorSounds returns true if arithmetic operators can be pronounced in
+// the given language.
+func hasOperatorSounds(lang string) bool {
+	return len(getVoice(lang).operators) == len(opChars)
+}
+
+// newAudio returns a new audio captcha encoded with the given options with
+// PRNG initialized from the given seed. Digits may include operator codes if
+// there are operator sounds for the language.
+func newAudio(seed [16]byte, digits []byte, lang string, opts AudioOptions) *Audio {
+	a := &Audio{opts: opts}
+	rate := opts.SampleRate
 
 	// Initialize PRNG.
-	a.rng.Seed(deriveSeed(audioSeedPurpose, id, digits))
+	a.rng.Seed(seed)
 
-	if sounds, ok := digitSounds[lang]; ok {
-		a.digitSounds = sounds
-	} else {
-		a.digitSounds = digitSounds["en"]
+	v := getVoice(lang).atRate(rate)
+	a.speakers = v.speakers
+	if !opts.MixSpeakers && len(v.speakers) > 1 {
+		i := a.rng.Intn(len(v.speakers))
+		a.speakers = v.speakers[i : i+1]
+	}
+	for _, n := range digits {
+		if n >= opPlus {
+			a.operatorSounds = v.operators
+			break
+		}
 	}
-	numsnd := make([][]byte, len(digits))
-	nsdur := 0
+	numsnd := make([]placedSound, len(digits))
 	for i, n := range digits {
-		snd := a.randomizedDigitSound(n)
-		nsdur += len(snd)
-		numsnd[i] = snd
+		numsnd[i] = a.randomizedDigitSound(n)
 	}
 	// Random intervals between digits (including beginning).
 	intervals := make([]int, len(digits)+1)
 	intdur := 0
 	for i := range intervals {
-		dur := a.rng.Int(sampleRate, sampleRate*3) // 1 to 3 seconds
+		dur := a.rng.Int(rate, rate*3) // 1 to 3 seconds
 		intdur += dur
 		intervals[i] = dur
 	}
-	// Generate background sound.
-	bg := a.makeBackgroundSound(a.longestDigitSndLen()*len(digits) + intdur)
-	// Create buffer and write audio to it.
-	sil := makeSilence(sampleRate / 5)
-	bufcap := 3*len(beepSound) + 2*len(sil) + len(bg) + len(endingBeepSound)
-	a.body = bytes.NewBuffer(make([]byte, 0, bufcap))
-	// Write prelude, three beeps.
-	a.body.Write(beepSound)
-	a.body.Write(sil)
-	a.body.Write(beepSound)
-	a.body.Write(sil)
-	a.body.Write(beepSound)
-	// Write digits.
-	pos := intervals[0]
+	// Prelude, three beeps.
+	beep, endingBeep := beepSounds(rate)
+	sil := rate / 5
+	pos := 0
+	for i := 0; i < 3; i++ {
+		a.sounds = append(a.sounds, newPlacedSound(beep, pos, 1, 1))
+		pos += len(beep) + sil
+	}
+	// Background sound.
+	a.noiseStart = pos - sil
+	a.makeBackgroundSound(a.longestDigitSndLen()*len(digits) + intdur)
+	// Digits.
+	pos = a.noiseStart + intervals[0]
 	for i, v := range numsnd {
-		mixSound(bg[pos:], v)
-		pos += len(v) + intervals[i+1]
+		v.pos = pos
+		a.sounds = append(a.sounds, v)
+		pos += v.n + intervals[i+1]
 	}
-	a.body.Write(bg)
-	// Write ending (one beep).
-	a.body.Write(endingBeepSound)
+	// Ending (one beep).
+	pos = a.noiseStart + a.noiseLen
+	a.sounds = append(a.sounds, newPlacedSound(endingBeep, pos, 1, 1))
+	a.length = pos + len(endingBeep)
 	return a
 }
 
+// render writes samples of audio starting from the given position to dst.
+func (a *Audio) render(dst []int16, pos int) {
+	end := pos + len(dst)
+	for i := range dst {
+		dst[i] = 0
+	}
+	if lo, hi := maxInt(pos, a.noiseStart), minInt(end, a.noiseStart+a.noiseLen); lo < hi {
+		a.whiteNoise(dst[lo-pos:hi-pos], lo-a.noiseStart, 4)
+	}
+	for i := range a.sounds {
+		s := &a.sounds[i]
+		if lo, hi := maxInt(pos, s.pos), minInt(end, s.pos+s.n); lo < hi {
+			s.mix(dst[lo-pos:hi-pos], lo-s.pos)
+		}
+	}
+}
+
+// waveHeaderLen is the length of WAVE header including the size of PCM chunk.
+const waveHeaderLen = 44
+
+// waveHeader returns the header of WAVE file with PCM data of the given
+// length in bytes, sample rate and bit depth.
+func waveHeader(dataLen, rate, bits int) []byte {
+	paddedLen := dataLen + dataLen%2
+	h := make([]byte, waveHeaderLen)
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], uint32(waveHeaderLen-8+paddedLen))
+	copy(h[8:], "WAVE")
+	copy(h[12:], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16) // length of format chunk
+	binary.LittleEndian.PutUint16(h[20:], 1)  // PCM
+	binary.LittleEndian.PutUint16(h[22:], 1)  // mono
+	binary.LittleEndian.PutUint32(h[24:], uint32(rate))
+	binary.LittleEndian.PutUint32(h[28:], uint32(rate*bits/8)) // bytes per second
+	binary.LittleEndian.PutUint16(h[32:], uint16(bits/8))      // bytes per sample
+	binary.LittleEndian.PutUint16(h[34:], uint16(bits))
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], uint32(dataLen))
+	return h
+}
+
+// dataLen returns the length of encoded PCM data in bytes.
+func (a *Audio) dataLen() int {
+	return a.length * a.opts.BitDepth / 8
+}
+
 // WriteTo writes captcha audio in WAVE format into the given io.Writer, and
 // returns the number of bytes written and an error if any.
 func (a *Audio) WriteTo(w io.Writer) (n int64, err error) {
-	// Calculate padded length of PCM chunk data.
-	bodyLen := uint32(a.body.Len())
-	paddedBodyLen := bodyLen
-	if bodyLen%2 != 0 {
-		paddedBodyLen++
-	}
-	totalLen := uint32(len(waveHeader)) - 4 + paddedBodyLen
-	// Header.
-	header := make([]byte, len(waveHeader)+4) // includes 4 bytes for chunk size
-	copy(header, waveHeader)
-	// Put the length of whole RIFF chunk.
-	binary.LittleEndian.PutUint32(header[4:], totalLen)
-	// Put the length of WAVE chunk.
-	binary.LittleEndian.PutUint32(header[len(waveHeader):], bodyLen)
-	// Write header.
-	nn, err := w.Write(header)
-	n = int64(nn)
-	if err != nil {
-		return
-	}
-	// Write data.
-	n, err = a.body.WriteTo(w)
-	n += int64(nn)
-	if err != nil {
-		return
-	}
-	// Pad byte if chunk length is odd.
-	// (As header has even length, we can check if n is odd, not chunk).
-	if bodyLen != paddedBodyLen {
-		w.Write([]byte{0})
-		n++
-	}
-	return
+	return io.Copy(w, a.NewReader())
 }
 
 // EncodedLen returns the length of WAV-encoded audio captcha.
 func (a *Audio) EncodedLen() int {
-	return len(waveHeader) + 4 + a.body.Len()
+	n := a.dataLen()
+	return waveHeaderLen + n + n%2
 }
 
-func (a *Audio) makeBackgroundSound(length int) []byte {
-	b := a.makeWhiteNoise(length, 4)
-	for i := 0; i < length/(sampleRate/10); i++ {
-		snd := reversedSound(a.digitSounds[a.rng.Intn(10)])
-		snd = changeSpeed(snd, a.rng.Float(0.8, 1.4))
-		place := a.rng.Intn(len(b) - len(snd))
-		setSoundLevel(snd, a.rng.Float(0.3, 0.46))
-		mixSound(b[place:], snd)
+// makeBackgroundSound adds background noise of the given length with
+// reversed sounds of digits.
+func (a *Audio) makeBackgroundSound(length int) {
+	var k [16]byte
+	binary.LittleEndian.PutUint64(k[0:], a.rng.Uint64())
+	binary.LittleEndian.PutUint64(k[8:], a.rng.Uint64())
+	a.noise.Seed(k)
+	a.noiseLen = length
+	for i := 0; i < length/(a.opts.SampleRate/10); i++ {
+		src := a.digitSound(byte(a.rng.Intn(10)))
+		s := newPlacedSound(src, 0, a.rng.Float(0.8, 1.4), 0)
+		s.reversed = true
+		s.pos = a.noiseStart + a.rng.Intn(length-s.n)
+		s.level = a.rng.Float(0.3, 0.46)
+		a.sounds = append(a.sounds, s)
 	}
-	return b
 }
 
-func (a *Audio) randomizedDigitSound(n byte) []byte {
-	s := a.randomSpeed(a.digitSounds[n])
-	setSoundLevel(s, a.rng.Float(0.75, 1.2))
-	return s
+// randomizedDigitSound returns a sound of the digit or operator with random
+// tempo, pitch and level. Its position is set by the caller.
+func (a *Audio) randomizedDigitSound(n byte) placedSound {
+	var src []int16
+	if n >= opPlus {
+		src = a.randomTake(a.operatorSounds[n-opPlus])
+	} else {
+		src = a.digitSound(n)
+	}
+	tempo := a.rng.Float(0.85, 1.2)
+	pitch := a.rng.Float(0.85, 1.15)
+	return newPlacedSound(changeVoice(src, tempo, pitch, a.opts.SampleRate), 0, 1, a.rng.Float(0.75, 1.2))
+}
+
+// digitSound returns a random take of the digit pronounced by one of the
+// speakers.
+func (a *Audio) digitSound(n byte) []int16 {
+	sp := a.speakers[0]
+	if len(a.speakers) > 1 {
+		sp = a.speakers[a.rng.Intn(len(a.speakers))]
+	}
+	return a.randomTake(sp.digits[n])
+}
+
+// randomTake returns one of the takes of a sound.
+func (a *Audio) randomTake(takes [][]int16) []int16 {
+	if len(takes) == 1 {
+		return takes[0]
+	}
+	return takes[a.rng.Intn(len(takes))]
 }
 
 func (a *Audio) longestDigitSndLen() int {
 	n := 0
-	for _, v := range a.digitSounds {
-		if n < len(v) {
-			n = len(v)
+	longest := func(sounds [][][]int16) {
+		for _, takes := range sounds {
+			for _, v := range takes {
+				if n < len(v) {
+					n = len(v)
+				}
+			}
 		}
 	}
+	for _, sp := range a.speakers {
+		longest(sp.digits)
+	}
+	longest(a.operatorSounds)
 	return n
 }
 
-func (a *Audio) randomSpeed(b []byte) []byte {
-	pitch := a.rng.Float(0.9, 1.2)
-	return changeSpeed(b, pitch)
+// whiteNoise writes background noise starting from the given position to
+// dst, with the amplitude of the given level on the scale of 8-bit samples.
+func (a *Audio) whiteNoise(dst []int16, pos int, level uint8) {
+	var buf [64]byte
+	for len(dst) > 0 {
+		b := buf[:minInt(len(buf), len(dst))]
+		a.noise.ReadAt(b, int64(pos))
+		for i, v := range b {
+			dst[i] = (int16(v%level) - int16(level/2)) << 8
+		}
+		dst = dst[len(b):]
+		pos += len(b)
+	}
 }
 
-func (a *Audio) makeWhiteNoise(length int, level uint8) []byte {
-	noise := a.rng.Bytes(length)
-	adj := 128 - level/2
-	for i, v := range noise {
-		v %= level
-		v += adj
-		noise[i] = v
+// clampSample returns v limited to the range of samples.
+func clampSample(v int) int16 {
+	switch {
+	case v > math.MaxInt16:
+		return math.MaxInt16
+	case v < math.MinInt16:
+		return math.MinInt16
 	}
-	return noise
+	return int16(v)
 }
 
-// mixSound mixes src into dst. Dst must have length equal to or greater than
-// src length.
-func mixSound(dst, src []byte) {
-	for i, v := range src {
-		av := int(v)
-		bv := int(dst[i])
-		if av < 128 && bv < 128 {
-			dst[i] = byte(av * bv / 128)
-		} else {
-			dst[i] = byte(2*(av+bv) - av*bv/128 - 256)
-		}
+// mixSample returns the sample of sound b mixed into a.
+func mixSample(a, b int16) int16 {
+	// Mix as unsigned samples.
+	av := int(b) + 32768
+	bv := int(a) + 32768
+	var r int
+	if av < 32768 && bv < 32768 {
+		r = av * bv / 32768
+	} else {
+		r = 2*(av+bv) - av*bv/32768 - 65536
 	}
+	return clampSample(r - 32768)
 }
 
-func setSoundLevel(a []byte, level float64) {
-	for i, v := range a {
-		av := float64(v)
-		switch {
-		case av > 128:
-			if av = (av-128)*level + 128; av < 128 {
-				av = 128
-			}
-		case av < 128:
-			if av = 128 - (128-av)*level; av > 128 {
-				av = 128
-			}
-		default:
-			continue
-		}
-		a[i] = byte(av)
+// decodePCM8 returns samples of unsigned 8-bit PCM data.
+func decodePCM8(b []byte) []int16 {
+	s := make([]int16, len(b))
+	for i, v := range b {
+		s[i] = (int16(v) - 128) << 8
 	}
+	return s
 }
 
-// changeSpeed returns new PCM bytes from the bytes with the speed and pitch
-// changed to the given value that must be in range [0, x].
-func changeSpeed(a []byte, speed float64) []byte {
-	b := make([]byte, int(math.Floor(float64(len(a))*speed)))
-	var p float64
-	for _, v := range a {
-		for i := int(p); i < int(p+speed); i++ {
-			b[i] = v
-		}
-		p += speed
+// decodePCM16 returns samples of signed 16-bit little-endian PCM data.
+func decodePCM16(b []byte) []int16 {
+	s := make([]int16, len(b)/2)
+	for i := range s {
+		s[i] = int16(binary.LittleEndian.Uint16(b[2*i:]))
 	}
-	return b
+	return s
 }
 
-func makeSilence(length int) []byte {
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = 128
+// appendPCM8 appends unsigned 8-bit PCM data of samples to b.
+func appendPCM8(b []byte, s []int16) []byte {
+	for _, v := range s {
+		// Round to the nearest 8-bit value.
+		u := (int(v) + 32768 + 128) >> 8
+		if u > 255 {
+			u = 255
+		}
+		b = append(b, byte(u))
 	}
 	return b
 }
 
-func reversedSound(a []byte) []byte {
-	n := len(a)
-	b := make([]byte, n)
-	for i, v := range a {
-		b[n-1-i] = v
+// appendPCM16 appends signed 16-bit little-endian PCM data of samples to b.
+func appendPCM16(b []byte, s []int16) []byte {
+	for _, v := range s {
+		b = append(b, byte(v), byte(uint16(v)>>8))
 	}
 	return b
 }
@@ -5,7 +5,15 @@
 package captcha
 
 import (
+	"bytes"
+	"encoding/binary"
+	"io"
 	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -30,3 +38,154 @@ func BenchmarkAudioWriteTo(b *testing.B) {
 		b.SetBytes(n)
 	}
 }
+
+func TestAudioFormat(t *testing.T) {
+	for _, opts := range []AudioOptions{DefaultAudio, WidebandAudio, HighQualityAudio, {SampleRate: 11025, BitDepth: 8}} {
+		a := NewAudioWithOptions("id", []byte{1, 2, 3, 4, 5, 6}, "", opts)
+		var buf bytes.Buffer
+		n, err := a.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		if n != int64(len(b)) || len(b) != a.EncodedLen() {
+			t.Errorf("%+v: wrote %d bytes, buffer has %d, EncodedLen is %d", opts, n, len(b), a.EncodedLen())
+		}
+		if string(b[0:4]) != "RIFF" || string(b[8:16]) != "WAVEfmt " || string(b[36:40]) != "data" {
+			t.Fatalf("%+v: bad WAVE header %x", opts, b[:waveHeaderLen])
+		}
+		if riff := binary.LittleEndian.Uint32(b[4:]); int(riff) != len(b)-8 {
+			t.Errorf("%+v: RIFF chunk length is %d, expected %d", opts, riff, len(b)-8)
+		}
+		rate := binary.LittleEndian.Uint32(b[24:])
+		bits := binary.LittleEndian.Uint16(b[34:])
+		if int(rate) != opts.SampleRate || int(bits) != opts.BitDepth {
+			t.Errorf("%+v: header has %d Hz, %d bits", opts, rate, bits)
+		}
+		// Duration doesn't depend on the format.
+		data := int(binary.LittleEndian.Uint32(b[40:]))
+		if d := float64(data) / float64(opts.SampleRate*opts.BitDepth/8); math.Abs(d-float64(a.length)/float64(opts.SampleRate)) > 0.01 {
+			t.Errorf("%+v: wrong duration %.2f s", opts, d)
+		}
+	}
+	for _, opts := range []AudioOptions{{}, {SampleRate: 8000, BitDepth: 24}, {SampleRate: 96000, BitDepth: 16}} {
+		if opts.validate() == nil {
+			t.Errorf("invalid options %+v accepted", opts)
+		}
+	}
+}
+
+func TestAudioSamples(t *testing.T) {
+	s := []int16{math.MinInt16, -256, 0, 255, math.MaxInt16}
+	if b := appendPCM8(nil, s); !bytes.Equal(b, []byte{0, 127, 128, 129, 255}) {
+		t.Errorf("appendPCM8: got %v", b)
+	}
+	if b := appendPCM16(nil, s[:2]); !bytes.Equal(b, []byte{0x00, 0x80, 0x00, 0xff}) {
+		t.Errorf("appendPCM16: got %v", b)
+	}
+	if s := decodePCM8([]byte{0, 128, 255}); s[0] != math.MinInt16 || s[1] != 0 || s[2] != 127<<8 {
+		t.Errorf("decodePCM8: got %v", s)
+	}
+	// Mixing with silence doesn't change sound.
+	for _, v := range []int16{math.MinInt16, -1000, 0, 1000, math.MaxInt16} {
+		if r := mixSample(0, v); r != v {
+			t.Errorf("mixSample(0, %d) = %d", v, r)
+		}
+	}
+	snd := newPlacedSound([]int16{-1000, 0, 1000, 20000}, 0, 2, 2)
+	snd.reversed = true
+	out := make([]int16, snd.n)
+	snd.mix(out, 0)
+	if snd.n != 8 || out[0] != math.MaxInt16 || out[2] != 2000 || out[3] != 1000 || out[4] != 0 || out[6] != -2000 {
+		t.Errorf("placed sound: got %d samples, %v", snd.n, out)
+	}
+	// Mixing in parts gives the same samples.
+	parts := make([]int16, snd.n)
+	snd.mix(parts[:3], 0)
+	snd.mix(parts[3:], 3)
+	if !reflect.DeepEqual(out, parts) {
+		t.Errorf("placed sound mixed in parts: got %v, expected %v", parts, out)
+	}
+}
+
+func TestAudioReader(t *testing.T) {
+	for _, opts := range []AudioOptions{DefaultAudio, HighQualityAudio, {SampleRate: 11025, BitDepth: 8}} {
+		a := NewAudioWithOptions("id", []byte{9, 8, 7, 6, 5, 4}, "", opts)
+		var buf bytes.Buffer
+		if _, err := a.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		full := buf.Bytes()
+		// Whole audio rendered at once is the same as rendered in chunks.
+		body := make([]int16, a.length)
+		a.render(body, 0)
+		var pcm []byte
+		if opts.BitDepth == 8 {
+			pcm = appendPCM8(nil, body)
+		} else {
+			pcm = appendPCM16(nil, body)
+		}
+		if !bytes.Equal(full[waveHeaderLen:waveHeaderLen+len(pcm)], pcm) {
+			t.Errorf("%+v: chunked audio differs from whole", opts)
+		}
+		// Read random ranges.
+		r := a.NewReader()
+		var rng siprng
+		rng.Seed([16]byte{byte(opts.SampleRate)})
+		for i := 0; i < 50; i++ {
+			off := rng.Intn(len(full))
+			n := rng.Intn(3 * audioChunkLen)
+			if _, err := r.Seek(int64(off), io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(io.LimitReader(r, int64(n)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if end := minInt(off+n, len(full)); !bytes.Equal(b, full[off:end]) {
+				t.Fatalf("%+v: range %d-%d differs", opts, off, end)
+			}
+		}
+		if n, _ := r.Seek(0, io.SeekEnd); n != int64(len(full)) {
+			t.Errorf("%+v: seek to end returned %d", opts, n)
+		}
+		if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("%+v: expected EOF, got %v", opts, err)
+		}
+	}
+}
+
+func TestSiprngReadAt(t *testing.T) {
+	var p siprng
+	p.Seed([16]byte{1, 2, 3})
+	all := p.Bytes(100)
+	for _, r := range [][2]int{{0, 100}, {3, 4}, {8, 16}, {13, 60}, {99, 1}} {
+		b := make([]byte, r[1])
+		p.ReadAt(b, int64(r[0]))
+		if !bytes.Equal(b, all[r[0]:r[0]+r[1]]) {
+			t.Errorf("ReadAt(%d, %d): got %x, expected %x", r[1], r[0], b, all[r[0]:r[0]+r[1]])
+		}
+	}
+}
+
+func TestServerAudioRange(t *testing.T) {
+	m := NewManager(Config{})
+	id := m.New()
+	var full bytes.Buffer
+	if err := m.WriteAudio(&full, id, ""); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/captcha/"+id+".wav", nil)
+	r.Header.Set("Range", "bytes=1000-1999")
+	m.Server().ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("expected status 206, got %d", w.Code)
+	}
+	if cr := w.Header().Get("Content-Range"); cr != "bytes 1000-1999/"+strconv.Itoa(full.Len()) {
+		t.Errorf("wrong Content-Range %q", cr)
+	}
+	if !bytes.Equal(w.Body.Bytes(), full.Bytes()[1000:2000]) {
+		t.Errorf("wrong range of audio")
+	}
+}
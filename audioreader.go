@@ -0,0 +1,112 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"errors"
+	"io"
+)
+
+// audioChunkLen is the number of encoded samples rendered at once.
+const audioChunkLen = 4096
+
+// audioReader reads WAVE-encoded audio, rendering it in chunks.
+type audioReader struct {
+	a      *Audio
+	off    int64
+	size   int64
+	header []byte
+	// Last rendered chunk.
+	chunk      []byte
+	chunkStart int64 // offset of chunk in PCM data, or -1
+	samples    []int16
+}
+
+// NewReader returns a reader of captcha audio in WAVE format. Audio is
+// rendered in chunks while it is read, so the whole file is never kept in
+// memory, and the reader can seek to any position, for example, to serve
+// range requests with http.ServeContent.
+func (a *Audio) NewReader() io.ReadSeeker {
+	return &audioReader{
+		a:          a,
+		size:       int64(a.EncodedLen()),
+		header:     waveHeader(a.dataLen(), a.opts.SampleRate, a.opts.BitDepth),
+		chunkStart: -1,
+	}
+}
+
+func (r *audioReader) Read(p []byte) (n int, err error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+	if rem := r.size - r.off; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+	for len(p) > 0 {
+		var nn int
+		switch d := r.off - waveHeaderLen; {
+		case d < 0:
+			nn = copy(p, r.header[r.off:])
+		case d >= int64(r.a.dataLen()):
+			p[0] = 0 // pad byte
+			nn = 1
+		default:
+			nn = copy(p, r.data(d))
+		}
+		n += nn
+		r.off += int64(nn)
+		p = p[nn:]
+	}
+	return n, nil
+}
+
+func (r *audioReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("captcha: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("captcha: negative position")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+// data returns PCM data starting at the given offset up to the end of the
+// chunk that contains it, rendering the chunk if needed.
+func (r *audioReader) data(off int64) []byte {
+	if r.chunkStart < 0 || off < r.chunkStart || off >= r.chunkStart+int64(len(r.chunk)) {
+		bps := int64(r.a.opts.BitDepth / 8)
+		r.render(int(off / bps / audioChunkLen * audioChunkLen))
+	}
+	return r.chunk[off-r.chunkStart:]
+}
+
+// render renders the chunk of encoded samples starting from i0.
+func (r *audioReader) render(i0 int) {
+	a := r.a
+	i1 := minInt(i0+audioChunkLen, a.length)
+	r.samples = resizeSamples(r.samples, i1-i0)
+	a.render(r.samples, i0)
+	if a.opts.BitDepth == 8 {
+		r.chunk = appendPCM8(r.chunk[:0], r.samples)
+	} else {
+		r.chunk = appendPCM16(r.chunk[:0], r.samples)
+	}
+	r.chunkStart = int64(i0 * a.opts.BitDepth / 8)
+}
+
+// resizeSamples returns a slice of n samples reusing s if it's large enough.
+func resizeSamples(s []int16, n int) []int16 {
+	if cap(s) < n {
+		return make([]int16, n)
+	}
+	return s[:n]
+}
@@ -3,15 +3,26 @@
 // license that can be found in the LICENSE file.
 
 // capgen is an utility to test captcha generation.
+//
+// With -n flag, it generates a dataset for training and evaluating OCR: the
+// given number of images in the directory, and a manifest with their
+// solutions and boxes of characters in JSON or CSV format.
 package main
 
 import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/dchest/captcha"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 var (
@@ -21,13 +32,131 @@ var (
 	flagLen   = flag.Int("len", captcha.DefaultLen, "length of captcha")
 	flagImgW  = flag.Int("width", captcha.StdWidth, "image captcha width")
 	flagImgH  = flag.Int("height", captcha.StdHeight, "image captcha height")
+	flagAlpha = flag.String("alphabet", captcha.DigitAlphabet.String(), "characters of captcha solution")
+	flagNum   = flag.Int("n", 0, "generate a dataset of n images in the directory")
+	flagMan   = flag.String("manifest", "json", "format of dataset manifest: json or csv")
+	flagLevel = flag.String("preset", "default", "image options preset: easy, default or hard")
 )
 
 func usage() {
 	fmt.Fprintf(os.Stderr, "usage: capgen [flags] filename\n")
+	fmt.Fprintf(os.Stderr, "       capgen -n count [flags] directory\n")
 	flag.PrintDefaults()
 }
 
+// label describes an image of a dataset.
+type label struct {
+	File     string       `json:"file"`
+	Solution string       `json:"solution"`
+	Glyphs   []glyphLabel `json:"glyphs"`
+}
+
+type glyphLabel struct {
+	Char    string   `json:"char"`
+	Bounds  [4]int   `json:"bounds"` // x0, y0, x1, y1
+	Skew    float64  `json:"skew"`
+	Polygon [][2]int `json:"polygon"`
+}
+
+func newLabel(file, solution string, img *captcha.Image) label {
+	l := label{File: file, Solution: solution}
+	for _, g := range img.Glyphs() {
+		b := g.Bounds
+		gl := glyphLabel{
+			Char:   string(g.Char),
+			Bounds: [4]int{b.Min.X, b.Min.Y, b.Max.X, b.Max.Y},
+			Skew:   g.Skew,
+		}
+		for _, p := range g.Polygon {
+			gl.Polygon = append(gl.Polygon, [2]int{p.X, p.Y})
+		}
+		l.Glyphs = append(l.Glyphs, gl)
+	}
+	return l
+}
+
+func writeJSON(w io.Writer, labels []label) error {
+	return json.NewEncoder(w).Encode(labels)
+}
+
+// writeCSV writes one row for each character. Polygon points are separated
+// by spaces, and coordinates by commas.
+func writeCSV(w io.Writer, labels []label) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"file", "solution", "index", "char", "x0", "y0", "x1", "y1", "skew", "polygon"})
+	for _, l := range labels {
+		for i, g := range l.Glyphs {
+			poly := make([]string, len(g.Polygon))
+			for j, p := range g.Polygon {
+				poly[j] = strconv.Itoa(p[0]) + "," + strconv.Itoa(p[1])
+			}
+			cw.Write([]string{
+				l.File, l.Solution, strconv.Itoa(i), g.Char,
+				strconv.Itoa(g.Bounds[0]), strconv.Itoa(g.Bounds[1]),
+				strconv.Itoa(g.Bounds[2]), strconv.Itoa(g.Bounds[3]),
+				strconv.FormatFloat(g.Skew, 'f', 3, 64),
+				strings.Join(poly, " "),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// randomId returns a new random captcha id. Images and audio are derived from
+// ids and solutions, so captchas with the same solution would be the same
+// without different ids.
+func randomId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("%s", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func dataset(dir string, alphabet *captcha.Alphabet, opts captcha.ImageOptions) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var write func(io.Writer, []label) error
+	switch *flagMan {
+	case "json":
+		write = writeJSON
+	case "csv":
+		write = writeCSV
+	default:
+		return fmt.Errorf("unknown manifest format %q", *flagMan)
+	}
+	labels := make([]label, 0, *flagNum)
+	width := len(strconv.Itoa(*flagNum))
+	for i := 0; i < *flagNum; i++ {
+		d := alphabet.Random(*flagLen)
+		img := captcha.NewImageWithOptions(randomId(), d, *flagImgW, *flagImgH, opts)
+		name := fmt.Sprintf("%0*d.png", width, i)
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		_, err = img.WriteTo(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		labels = append(labels, newLabel(name, alphabet.Format(d), img))
+	}
+	f, err := os.Create(filepath.Join(dir, "labels."+*flagMan))
+	if err != nil {
+		return err
+	}
+	if err := write(f, labels); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func main() {
 	flag.Parse()
 	fname := flag.Arg(0)
@@ -35,22 +164,44 @@ func main() {
 		usage()
 		os.Exit(1)
 	}
+	alphabet, err := captcha.NewAlphabet(*flagAlpha)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	captcha.SetAlphabet(alphabet)
+	if *flagNum > 0 {
+		var opts captcha.ImageOptions
+		switch *flagLevel {
+		case "easy":
+			opts = captcha.EasyImage
+		case "default":
+			opts = captcha.DefaultImage
+		case "hard":
+			opts = captcha.HardImage
+		default:
+			log.Fatalf("unknown preset %q", *flagLevel)
+		}
+		if err := dataset(fname, alphabet, opts); err != nil {
+			log.Fatalf("%s", err)
+		}
+		return
+	}
 	f, err := os.Create(fname)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
 	defer f.Close()
 	var w io.WriterTo
-	d := captcha.RandomDigits(*flagLen)
+	d := alphabet.Random(*flagLen)
 	switch {
 	case *flagAudio:
-		w = captcha.NewAudio("", d, *flagLang)
+		w = captcha.NewAudio(randomId(), d, *flagLang)
 	case *flagImage:
-		w = captcha.NewImage("", d, *flagImgW, *flagImgH)
+		w = captcha.NewImage(randomId(), d, *flagImgW, *flagImgH)
 	}
 	_, err = w.WriteTo(f)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
-	fmt.Println(d)
+	fmt.Println(alphabet.Format(d))
 }
@@ -66,6 +66,27 @@ func writeDigitSounds(pcm io.Writer, lang string) {
 	fmt.Fprintf(pcm, "\t},\n")
 }
 
+// operators are names of files with sounds of arithmetic operators, in order
+// of operator codes.
+var operators = []string{"plus", "minus", "times", "equals"}
+
+// writeOperatorSounds writes sounds of operators for the language if there
+// are files for all of them.
+func writeOperatorSounds(pcm io.Writer, lang string) {
+	for _, op := range operators {
+		if _, err := os.Stat(filepath.Join(lang, op+".wav")); err != nil {
+			return
+		}
+	}
+	fmt.Fprintf(pcm, "\t\"%s\": [][]byte{\n", lang)
+	for _, op := range operators {
+		fmt.Fprintf(pcm, "\t\t{ // %s\n\t\t\t", op)
+		writeFileRep(pcm, filepath.Join(lang, op+".wav"), "\t\t\t")
+		fmt.Fprintf(pcm, "\t\t},\n")
+	}
+	fmt.Fprintf(pcm, "\t},\n")
+}
+
 func main() {
 	pcm, err := os.Create(filepath.Join("..", "sounds.go"))
 	if err != nil {
@@ -76,13 +97,6 @@ func main() {
 
 // This file has been generated from .wav files using generate.go.
 
-var waveHeader = []byte{
-	0x52, 0x49, 0x46, 0x46, 0x00, 0x00, 0x00, 0x00, 0x57, 0x41, 0x56, 0x45,
-	0x66, 0x6d, 0x74, 0x20, 0x10, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00,
-	0x40, 0x1f, 0x00, 0x00, 0x40, 0x1f, 0x00, 0x00, 0x01, 0x00, 0x08, 0x00,
-	0x64, 0x61, 0x74, 0x61,
-}
-
 // Byte slices contain raw 8 kHz unsigned 8-bit PCM data (without wav header).
 
 `)
@@ -92,4 +106,10 @@ var waveHeader = []byte{
 	}
 	fmt.Fprintf(pcm, "}\n")
 	writeSingle(pcm, "beep")
+	fmt.Fprintf(pcm, "\n// Sounds of arithmetic operators: plus, minus, times, equals. There are no\n// recordings of them for built-in languages yet.\n")
+	fmt.Fprintf(pcm, "var operatorSounds = map[string][][]byte{\n")
+	for _, lang := range langs {
+		writeOperatorSounds(pcm, lang)
+	}
+	fmt.Fprintf(pcm, "}\n")
 }
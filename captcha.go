@@ -10,12 +10,16 @@
 //
 // An image representation is a PNG-encoded image with the solution printed on
 // it in such a way that makes it hard for computers to solve it using OCR.
+// Images can also be encoded as JPEG, lossless WebP, animated GIF or SVG, or
+// with an Encoder added with RegisterEncoder.
 //
-// An audio representation is a WAVE-encoded (8 kHz unsigned 8-bit) sound with
-// the spoken solution (currently in English, Russian, Chinese, and Japanese).
-// To make it hard for computers to solve audio captcha, the voice that
-// pronounces numbers has random speed and pitch, and there is a randomly
-// generated background noise mixed into the sound.
+// An audio representation is a WAVE-encoded sound (8 kHz unsigned 8-bit by
+// default, or another format chosen with AudioOptions) with the spoken
+// solution (built-in voices speak English, Russian, Chinese, Japanese, and
+// Portuguese; others can be added with RegisterVoice). To make it hard for
+// computers to solve audio captcha, the voice that pronounces numbers has
+// random tempo and pitch, and there is a randomly generated background noise
+// mixed into the sound.
 //
 // This package doesn't require external files or libraries to generate captcha
 // representations; it is self-contained.
@@ -27,7 +31,14 @@
 // form) are collected automatically after the predefined expiration time.
 // Developers can also provide custom store (for example, which saves captcha
 // ids and solutions in database) by implementing Store interface and
-// registering the object with SetCustomStore.
+// registering the object with SetCustomStore. Stores that can fail, such as
+// database-backed ones, should implement StoreContext interface instead, so
+// that errors are reported by the functions accepting a context (for example,
+// VerifyContext) instead of being treated as missing captchas.
+//
+// Alternatively, captchas can be stateless: NewToken returns an encrypted
+// token containing the solution, which is used in place of an id, and
+// VerifyToken checks it without the store.
 //
 // Captchas are created by calling New, which returns the captcha id.  Their
 // representations, though, are created on-the-fly by calling WriteImage or
@@ -37,16 +48,24 @@
 // the provided captcha, allowing users to "reload" captcha if they can't solve
 // the displayed one without reloading the whole page.  Verify and VerifyString
 // are used to verify that the given solution is the right one for the given
-// captcha id.
+// captcha id. Check does the same, but also tells whether the solution was
+// wrong, or the captcha expired, or there were too many attempts to solve it
+// (see SetMaxAttempts).
 //
 // Server provides an http.Handler which can serve image and audio
 // representations of captchas automatically from the URL. It can also be used
 // to reload captchas.  Refer to Server function documentation for details, or
 // take a look at the example in "capexample" subdirectory.
+//
+// Package-level functions use a default Manager. Programs that need several
+// independent configurations in one process (for example, different stores or
+// image sizes for different sites) can create their own managers with
+// NewManager and use their methods, which mirror the package functions.
 package captcha
 
 import (
-	"bytes"
+	"context"
+	"crypto/subtle"
 	"errors"
 	"io"
 	"time"
@@ -58,34 +77,75 @@ const (
 	// The number of captchas created that triggers garbage collection used
 	// by default store.
 	CollectNum = 100
-	// Expiration time of captchas used by default store.
+	// Default expiration time of captchas.
 	Expiration = 10 * time.Minute
 )
 
 var (
 	ErrNotFound = errors.New("captcha: id not found")
-	// globalStore is a shared storage for captchas, generated by New function.
-	globalStore = NewMemoryStore(CollectNum, Expiration)
+	ErrExpired  = errors.New("captcha: expired")
+	ErrNoAudio  = errors.New("captcha: audio is not available")
 )
 
 // SetCustomStore sets custom storage for captchas, replacing the default
 // memory store. This function must be called before generating any captchas.
 func SetCustomStore(s Store) {
-	globalStore = s
+	defaultManager.store = WrapStore(s)
+}
+
+// SetCustomStoreContext is like SetCustomStore, but accepts a store
+// implementing StoreContext interface.
+func SetCustomStoreContext(s StoreContext) {
+	defaultManager.store = s
 }
 
 // New creates a new captcha with the standard length, saves it in the internal
 // storage and returns its id.
 func New() string {
-	return NewLen(DefaultLen)
+	return defaultManager.New()
 }
 
 // NewLen is just like New, but accepts length of a captcha solution as the
 // argument.
 func NewLen(length int) (id string) {
-	id = randomId()
-	globalStore.Set(id, RandomDigits(length))
-	return
+	return defaultManager.NewLen(length)
+}
+
+// NewLenTTL is just like NewLen, but the created captcha expires after the
+// given ttl instead of the default expiration time.
+func NewLenTTL(length int, ttl time.Duration) (id string) {
+	return defaultManager.NewLenTTL(length, ttl)
+}
+
+// NewArithmetic creates a new arithmetic challenge, such as "7 + 12 =", and
+// returns its id. The solution is the answer. It panics if there are no
+// sounds of operators for the default language. See SetArithmetic and
+// Manager.NewArithmetic.
+func NewArithmetic() (id string) {
+	return defaultManager.NewArithmetic()
+}
+
+// SetArithmetic sets settings of arithmetic challenges created by the default
+// manager. It panics if the settings are invalid.
+func SetArithmetic(a Arithmetic) {
+	a, err := a.withDefaults()
+	if err != nil {
+		panic(err)
+	}
+	defaultManager.arithmetic = a
+}
+
+// NewWithOptions creates a new captcha with the given options, saves it in
+// the store and returns its id. It returns an error if the captcha can't be
+// saved in the store.
+func NewWithOptions(ctx context.Context, opts Options) (id string, err error) {
+	return defaultManager.NewWithOptions(ctx, opts)
+}
+
+// NewLenContext is like NewLen, but accepts a context and returns an error if
+// the captcha can't be saved in the store.
+func NewLenContext(ctx context.Context, length int) (id string, err error) {
+	return defaultManager.NewLenContext(ctx, length)
 }
 
 // Reload generates and remembers new digits for the given captcha id.  This
@@ -95,71 +155,181 @@ func NewLen(length int) (id string) {
 // refreshed to show the new captcha representation (WriteImage and WriteAudio
 // will write the new one).
 func Reload(id string) bool {
-	old := globalStore.Get(id, false)
-	if old == nil {
-		return false
-	}
-	globalStore.Set(id, RandomDigits(len(old)))
-	return true
+	return defaultManager.Reload(id)
+}
+
+// ReloadContext is like Reload, but accepts a context and returns ErrNotFound
+// if there is no captcha with the given id, or other error returned by the
+// store.
+func ReloadContext(ctx context.Context, id string) error {
+	return defaultManager.ReloadContext(ctx, id)
 }
 
 // WriteImage writes PNG-encoded image representation of the captcha with the
 // given id. The image will have the given width and height.
 func WriteImage(w io.Writer, id string, width, height int) error {
-	d := globalStore.Get(id, false)
-	if d == nil {
-		return ErrNotFound
-	}
-	_, err := NewImage(id, d, width, height).WriteTo(w)
-	return err
+	return defaultManager.WriteImage(w, id, width, height)
+}
+
+// WriteImageContext is like WriteImage, but accepts a context. It returns
+// ErrNotFound if there is no captcha with the given id, or other error
+// returned by the store.
+func WriteImageContext(ctx context.Context, w io.Writer, id string, width, height int) error {
+	return defaultManager.WriteImageContext(ctx, w, id, width, height)
+}
+
+// WriteEncodedImage writes image representation of the captcha with the given
+// id encoded with the given encoder, such as JPEGEncoder. The image will have
+// the given width and height.
+func WriteEncodedImage(w io.Writer, id string, width, height int, e Encoder) error {
+	return defaultManager.WriteEncodedImage(w, id, width, height, e)
+}
+
+// WriteEncodedImageContext is like WriteEncodedImage, but accepts a context.
+// It returns ErrNotFound if there is no captcha with the given id, or other
+// error returned by the store.
+func WriteEncodedImageContext(ctx context.Context, w io.Writer, id string, width, height int, e Encoder) error {
+	return defaultManager.WriteEncodedImageContext(ctx, w, id, width, height, e)
+}
+
+// WriteAnimatedImage writes animated GIF-encoded image representation of the
+// captcha with the given id. The image will have the given width and height.
+func WriteAnimatedImage(w io.Writer, id string, width, height int) error {
+	return defaultManager.WriteAnimatedImage(w, id, width, height)
+}
+
+// WriteAnimatedImageContext is like WriteAnimatedImage, but accepts a
+// context. It returns ErrNotFound if there is no captcha with the given id,
+// or other error returned by the store.
+func WriteAnimatedImageContext(ctx context.Context, w io.Writer, id string, width, height int) error {
+	return defaultManager.WriteAnimatedImageContext(ctx, w, id, width, height)
+}
+
+// WriteSVGImage writes SVG-encoded vector image representation of the
+// captcha with the given id. The image will have the given width and height.
+func WriteSVGImage(w io.Writer, id string, width, height int) error {
+	return defaultManager.WriteSVGImage(w, id, width, height)
+}
+
+// WriteSVGImageContext is like WriteSVGImage, but accepts a context. It
+// returns ErrNotFound if there is no captcha with the given id, or other error
+// returned by the store.
+func WriteSVGImageContext(ctx context.Context, w io.Writer, id string, width, height int) error {
+	return defaultManager.WriteSVGImageContext(ctx, w, id, width, height)
 }
 
 // WriteAudio writes WAV-encoded audio representation of the captcha with the
 // given id and the given language. If there are no sounds for the given
 // language, English is used.
 func WriteAudio(w io.Writer, id string, lang string) error {
-	d := globalStore.Get(id, false)
-	if d == nil {
-		return ErrNotFound
-	}
-	_, err := NewAudio(id, d, lang).WriteTo(w)
-	return err
+	return defaultManager.WriteAudio(w, id, lang)
+}
+
+// WriteAudioContext is like WriteAudio, but accepts a context. It returns
+// ErrNotFound if there is no captcha with the given id, or other error
+// returned by the store.
+func WriteAudioContext(ctx context.Context, w io.Writer, id string, lang string) error {
+	return defaultManager.WriteAudioContext(ctx, w, id, lang)
 }
 
 // Verify returns true if the given digits are the ones that were used to
 // create the given captcha id.
 //
 // The function deletes the captcha with the given id from the internal
-// storage, so that the same captcha can't be verified anymore.
+// storage, so that the same captcha can't be verified anymore. By default,
+// this happens after the first attempt; see SetMaxAttempts.
 func Verify(id string, digits []byte) bool {
-	if digits == nil || len(digits) == 0 {
-		return false
-	}
-	reald := globalStore.Get(id, true)
-	if reald == nil {
-		return false
-	}
-	return bytes.Equal(digits, reald)
+	return defaultManager.Verify(id, digits)
 }
 
-// VerifyString is like Verify, but accepts a string of digits.  It removes
-// spaces and commas from the string, but any other characters, apart from
-// digits and listed above, will cause the function to return false.
+// VerifyContext is like Verify, but accepts a context. It returns false and
+// ErrNotFound or ErrExpired if there is no captcha with the given id, or
+// false and other error returned by the store. Wrong solutions are reported
+// as false with nil error.
+func VerifyContext(ctx context.Context, id string, digits []byte) (bool, error) {
+	return defaultManager.VerifyContext(ctx, id, digits)
+}
+
+// VerifyString is like Verify, but accepts a string of characters of the
+// default manager's alphabet (digits, unless changed with SetAlphabet), which
+// are compared case-insensitively. It removes spaces and commas from the
+// string, but any other characters, apart from the alphabet's characters and
+// listed above, will cause the function to return false. If the alphabet was
+// made with WithLookalikes, characters that look like the alphabet's ones,
+// such as O for 0, are accepted in their place. See Manager.VerifyString.
 func VerifyString(id string, digits string) bool {
-	if digits == "" {
-		return false
+	return defaultManager.VerifyString(id, digits)
+}
+
+// SetAlphabet sets the alphabet of solutions of captchas created by the
+// default manager. This function must be called before generating any
+// captchas.
+func SetAlphabet(a *Alphabet) {
+	defaultManager.alphabet = a
+}
+
+// Check checks whether the given digits are the solution of the captcha with
+// the given id, and tells why they are not. See Manager.Check for details.
+func Check(ctx context.Context, id string, digits []byte) (Result, error) {
+	return defaultManager.Check(ctx, id, digits)
+}
+
+// CheckString is like Check, but accepts a string of digits.
+func CheckString(ctx context.Context, id string, digits string) (Result, error) {
+	return defaultManager.CheckString(ctx, id, digits)
+}
+
+// SetMaxAttempts sets the number of attempts to solve a captcha before it is
+// deleted from the store of the default manager. Stores set with
+// SetCustomStore allow only one attempt, unless they implement AttemptStore.
+func SetMaxAttempts(n int) {
+	if n < 1 {
+		n = 1
 	}
-	ns := make([]byte, len(digits))
-	for i := range ns {
-		d := digits[i]
-		switch {
-		case '0' <= d && d <= '9':
-			ns[i] = d - '0'
-		case d == ' ' || d == ',':
-			// ignore
-		default:
-			return false
-		}
+	defaultManager.maxAttempts = n
+}
+
+// NewToken creates a new captcha with the standard length and returns a token
+// containing its encrypted solution instead of saving it in the store. See
+// Manager.NewToken for details.
+func NewToken() string {
+	return defaultManager.NewToken()
+}
+
+// NewTokenLen is just like NewToken, but accepts length of a captcha solution
+// as the argument.
+func NewTokenLen(length int) string {
+	return defaultManager.NewTokenLen(length)
+}
+
+// VerifyToken returns true if the given digits are the solution of the
+// captcha in the given token. Each token can be verified only once.
+func VerifyToken(token string, digits []byte) bool {
+	return defaultManager.VerifyToken(token, digits)
+}
+
+// VerifyTokenString is like VerifyToken, but accepts a string of digits.
+func VerifyTokenString(token string, digits string) bool {
+	return defaultManager.VerifyTokenString(token, digits)
+}
+
+// equalDigits reports whether the given digits are equal to the real ones in
+// constant time. Its running time depends only on the length of the given
+// digits, which is known to the caller, and not on the real digits or their
+// length, or the position of the first mismatch.
+func equalDigits(given, real []byte) bool {
+	eq := subtle.ConstantTimeEq(int32(len(given)), int32(len(real)))
+	if len(real) == 0 {
+		real = dummyDigits
+	}
+	var d byte
+	for i := range given {
+		d |= given[i] ^ real[i%len(real)]
 	}
-	return Verify(id, ns)
+	return eq&subtle.ConstantTimeByteEq(d, 0) == 1
 }
+
+// dummyDigits are compared with the given digits when there are no real
+// ones, so that verification of missing captchas takes as long as
+// verification of wrong solutions.
+var dummyDigits = []byte{0xff}
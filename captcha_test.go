@@ -22,7 +22,7 @@ func TestVerify(t *testing.T) {
 		t.Errorf("verified wrong captcha")
 	}
 	id = New()
-	d := globalStore.Get(id, false) // cheating
+	d := getDigits(defaultManager, id) // cheating
 	if !Verify(id, d) {
 		t.Errorf("proper captcha not verified")
 	}
@@ -30,9 +30,9 @@ func TestVerify(t *testing.T) {
 
 func TestReload(t *testing.T) {
 	id := New()
-	d1 := globalStore.Get(id, false) // cheating
+	d1 := getDigits(defaultManager, id) // cheating
 	Reload(id)
-	d2 := globalStore.Get(id, false) // cheating again
+	d2 := getDigits(defaultManager, id) // cheating again
 	if bytes.Equal(d1, d2) {
 		t.Errorf("reload didn't work: %v = %v", d1, d2)
 	}
@@ -50,3 +50,34 @@ func TestRandomDigits(t *testing.T) {
 		t.Errorf("digits seem to be not random")
 	}
 }
+
+func TestEqualDigits(t *testing.T) {
+	tests := []struct {
+		given, real []byte
+		equal       bool
+	}{
+		{[]byte{1, 2, 3}, []byte{1, 2, 3}, true},
+		{[]byte{1, 2, 3}, []byte{1, 2, 4}, false},
+		{[]byte{0, 2, 3}, []byte{1, 2, 3}, false},
+		{[]byte{1, 2}, []byte{1, 2, 3}, false},
+		{[]byte{1, 2, 3, 1}, []byte{1, 2, 3}, false},
+		{[]byte{1, 2, 3}, []byte{1, 2, 3, 4, 5, 6}, false},
+		{[]byte{1}, nil, false},
+		{nil, []byte{1}, false},
+		{nil, nil, true},
+		{[]byte{0xff}, dummyDigits, true},
+	}
+	for i, test := range tests {
+		if eq := equalDigits(test.given, test.real); eq != test.equal {
+			t.Errorf("%d: equalDigits(%v, %v) = %v, expected %v", i, test.given, test.real, eq, test.equal)
+		}
+	}
+}
+
+func TestVerifyNotFoundCompares(t *testing.T) {
+	// Digits that can't be the solution must not verify missing captchas,
+	// even though they are compared with dummy digits.
+	if Verify("nonexistent", dummyDigits) {
+		t.Errorf("nonexistent captcha verified with dummy digits")
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encoder encodes captcha images into some format.
+type Encoder interface {
+	// ContentType returns the MIME type of encoded images, for example,
+	// "image/png".
+	ContentType() string
+	// Encode writes the image into the given writer.
+	Encode(w io.Writer, m *Image) error
+}
+
+// PNGEncoder encodes images in PNG format.
+type PNGEncoder struct{}
+
+func (PNGEncoder) ContentType() string { return "image/png" }
+
+func (PNGEncoder) Encode(w io.Writer, m *Image) error { return png.Encode(w, m.Paletted) }
+
+// JPEGEncoder encodes images in JPEG format with the given quality, ranging
+// from 1 to 100. Compression artifacts make images harder to recognize for
+// naive OCR.
+type JPEGEncoder struct {
+	Quality int
+}
+
+func (JPEGEncoder) ContentType() string { return "image/jpeg" }
+
+func (e JPEGEncoder) Encode(w io.Writer, m *Image) error { return m.WriteJPEG(w, e.Quality) }
+
+// WebPEncoder encodes images in lossless WebP format.
+type WebPEncoder struct{}
+
+func (WebPEncoder) ContentType() string { return "image/webp" }
+
+func (WebPEncoder) Encode(w io.Writer, m *Image) error { return m.WriteWebP(w) }
+
+// WriteJPEG writes captcha image in JPEG format with the given quality,
+// ranging from 1 to 100, into the given writer. JPEG doesn't support
+// transparency, so transparent background becomes white, or black if the
+// palette is Dark.
+func (m *Image) WriteJPEG(w io.Writer, quality int) error {
+	rgba := image.NewRGBA(m.Bounds())
+	bg := image.NewUniform(m.opts.Palette.backdrop())
+	draw.Draw(rgba, rgba.Bounds(), bg, image.Point{}, draw.Src)
+	src := *m.Paletted
+	if m.opts.Palette.Background == nil {
+		// Transparent white of the palette is not a valid premultiplied
+		// color, and would be drawn as white.
+		src.Palette = append(color.Palette{color.Transparent}, src.Palette[1:]...)
+	}
+	draw.Draw(rgba, rgba.Bounds(), &src, m.Bounds().Min, draw.Over)
+	return jpeg.Encode(w, rgba, &jpeg.Options{Quality: quality})
+}
+
+var (
+	encodersMu sync.RWMutex
+	// encoders maps file extensions to encoders.
+	encoders = map[string]Encoder{
+		".png":  PNGEncoder{},
+		".jpg":  JPEGEncoder{jpeg.DefaultQuality},
+		".jpeg": JPEGEncoder{jpeg.DefaultQuality},
+		".webp": WebPEncoder{},
+	}
+	// encoderExts lists extensions in order of registration, which is the
+	// order of preference for content negotiation.
+	encoderExts = []string{".png", ".jpg", ".jpeg", ".webp"}
+)
+
+// RegisterEncoder registers the image encoder for the given file extension,
+// such as ".jpg", replacing the previously registered one. Server serves
+// images with this extension, or the encoder's content type if requested
+// in the Accept header, using the encoder.
+func RegisterEncoder(ext string, e Encoder) {
+	ext = strings.ToLower(ext)
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	if _, ok := encoders[ext]; !ok {
+		encoderExts = append(encoderExts, ext)
+	}
+	encoders[ext] = e
+}
+
+// encoderForExt returns the encoder registered for the given extension.
+func encoderForExt(ext string) (Encoder, bool) {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	e, ok := encoders[strings.ToLower(ext)]
+	return e, ok
+}
+
+// encoderForAccept returns the extension of the most preferred image format
+// listed in the Accept header value. If the header is empty, or accepts any
+// image, it returns ".png".
+func encoderForAccept(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	bestExt, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		typ := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+		if typ == "*/*" || typ == "image/*" {
+			bestExt, bestQ = ".png", q
+			continue
+		}
+		for _, ext := range encoderExts {
+			if encoders[ext].ContentType() == typ {
+				bestExt, bestQ = ext, q
+				break
+			}
+		}
+	}
+	return bestExt, bestExt != ""
+}
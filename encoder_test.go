@@ -0,0 +1,132 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"bytes"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteJPEG(t *testing.T) {
+	img := NewImage("id", RandomDigits(6), StdWidth, StdHeight)
+	var buf bytes.Buffer
+	if err := img.WriteJPEG(&buf, 50); err != nil {
+		t.Fatal(err)
+	}
+	d, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Bounds() != img.Bounds() {
+		t.Errorf("expected bounds %v, got %v", img.Bounds(), d.Bounds())
+	}
+	// Transparent background must become white, not black.
+	if r, g, b, _ := d.At(0, 0).RGBA(); r < 0xe000 || g < 0xe000 || b < 0xe000 {
+		t.Errorf("background is not white")
+	}
+}
+
+func TestWriteJPEGContrast(t *testing.T) {
+	for _, p := range []Palette{{}, DarkPalette} {
+		opts := DefaultImage
+		opts.Palette = p
+		img := NewImageWithOptions("id", RandomDigits(6), StdWidth, StdHeight, opts)
+		var buf bytes.Buffer
+		if err := img.WriteJPEG(&buf, 100); err != nil {
+			t.Fatal(err)
+		}
+		d, err := jpeg.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Find the most contrasting pixel of digits.
+		bg := d.At(0, 0)
+		max := 0.0
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if img.ColorIndexAt(x, y) != 1 {
+					continue
+				}
+				if c := ContrastRatio(d.At(x, y), bg); c > max {
+					max = c
+				}
+			}
+		}
+		if max < p.minContrast() {
+			t.Errorf("Dark=%v: contrast %.2f is lower than %.2f", p.Dark, max, p.minContrast())
+		}
+	}
+}
+
+func TestEncoderForAccept(t *testing.T) {
+	tests := []struct {
+		accept, ext string
+	}{
+		{"", ".png"},
+		{"*/*", ".png"},
+		{"image/webp,image/*;q=0.8", ".webp"},
+		{"image/jpeg;q=0.5, image/png", ".png"},
+		{"image/png;q=0.5, image/jpeg", ".jpg"},
+		{"image/avif, text/html;q=0.9, image/*;q=0.1", ".png"},
+		{"text/html", ""},
+	}
+	for _, test := range tests {
+		ext, ok := encoderForAccept(test.accept)
+		if ext != test.ext || ok != (test.ext != "") {
+			t.Errorf("%q: expected %q, got %q", test.accept, test.ext, ext)
+		}
+	}
+}
+
+type rawEncoder struct{}
+
+func (rawEncoder) ContentType() string { return "image/x-raw" }
+
+func (rawEncoder) Encode(w io.Writer, m *Image) error {
+	_, err := w.Write(m.Pix)
+	return err
+}
+
+func TestServerEncoders(t *testing.T) {
+	RegisterEncoder(".raw", rawEncoder{})
+	m := NewManager(Config{})
+	id := m.New()
+	tests := []struct {
+		path, accept, contentType string
+	}{
+		{id + ".jpg", "", "image/jpeg"},
+		{id + ".webp", "", "image/webp"},
+		{id + ".raw", "", "image/x-raw"},
+		{id, "image/webp,*/*;q=0.8", "image/webp"},
+		{id, "image/x-raw", "image/x-raw"},
+		{id, "", "image/png"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/captcha/"+test.path, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		m.Server().ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", test.path, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != test.contentType {
+			t.Errorf("%s (Accept: %q): expected %s, got %q", test.path, test.accept, test.contentType, ct)
+		}
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/captcha/"+id, nil)
+	r.Header.Set("Accept", "text/html")
+	m.Server().ServeHTTP(w, r)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("expected status 406, got %d", w.Code)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxFontSize is the maximum width and height of glyphs of loaded fonts.
+const MaxFontSize = 64
+
+var errNoGlyphs = errors.New("captcha: font has no glyphs")
+
+// LoadFontPNG loads a font from a PNG sprite sheet: an image with glyphs of
+// the given characters laid out left to right in cells of equal width. Dark
+// opaque pixels are dots. Empty rows and columns around glyphs are trimmed.
+func LoadFontPNG(r io.Reader, chars string) (*Font, error) {
+	img, err := png.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewFontFromImage(img, chars)
+}
+
+// NewFontFromImage is like LoadFontPNG, but accepts a decoded image.
+func NewFontFromImage(img image.Image, chars string) (*Font, error) {
+	if chars == "" {
+		return nil, errNoGlyphs
+	}
+	b := img.Bounds()
+	if b.Dx()%len(chars) != 0 {
+		return nil, errors.New("captcha: width of sprite sheet is not a multiple of the number of characters")
+	}
+	f := &Font{width: b.Dx() / len(chars), height: b.Dy()}
+	for i := 0; i < len(chars); i++ {
+		g := make([]byte, f.width*f.height)
+		for y := 0; y < f.height; y++ {
+			for x := 0; x < f.width; x++ {
+				c := color.NRGBAModel.Convert(img.At(b.Min.X+i*f.width+x, b.Min.Y+y)).(color.NRGBA)
+				if c.A >= 0x80 && relativeLuminance(c) < 0.5 {
+					g[y*f.width+x] = blackChar
+				}
+			}
+		}
+		f.glyphs[chars[i]] = g
+	}
+	return f.trim()
+}
+
+// LoadFontBDF loads a font in Glyph Bitmap Distribution Format (BDF). Only
+// glyphs of characters with codes below 256 are loaded. Empty rows and
+// columns around glyphs are trimmed.
+func LoadFontBDF(r io.Reader) (*Font, error) {
+	s := bufio.NewScanner(r)
+	var (
+		fw, fh, fx, fy int // font bounding box
+		bw, bh, bx, by int // glyph bounding box
+		enc            = -1
+		f              *Font
+		g              []byte
+		row            = -1 // row of bitmap being read, or -1
+	)
+	ints := func(fields []string, n int) ([]int, error) {
+		if len(fields) < n+1 {
+			return nil, errors.New("captcha: bad BDF line " + strconv.Quote(strings.Join(fields, " ")))
+		}
+		v := make([]int, n)
+		for i := range v {
+			var err error
+			if v[i], err = strconv.Atoi(fields[i+1]); err != nil {
+				return nil, errors.New("captcha: bad BDF line " + strconv.Quote(strings.Join(fields, " ")))
+			}
+		}
+		return v, nil
+	}
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if row >= 0 && fields[0] != "ENDCHAR" {
+			// Bitmap row of the glyph.
+			bits, err := hex.DecodeString(fields[0])
+			if err != nil || len(bits)*8 < bw || row >= bh {
+				return nil, errors.New("captcha: bad BDF bitmap")
+			}
+			if g != nil {
+				y := fy + fh - by - bh + row
+				for i := 0; i < bw; i++ {
+					x := bx - fx + i
+					if bits[i/8]&(0x80>>uint(i%8)) != 0 && x >= 0 && x < fw && y >= 0 && y < fh {
+						g[y*fw+x] = blackChar
+					}
+				}
+			}
+			row++
+			continue
+		}
+		switch fields[0] {
+		case "FONTBOUNDINGBOX":
+			v, err := ints(fields, 4)
+			if err != nil {
+				return nil, err
+			}
+			fw, fh, fx, fy = v[0], v[1], v[2], v[3]
+			if fw <= 0 || fh <= 0 || fw > 4*MaxFontSize || fh > 4*MaxFontSize {
+				return nil, errors.New("captcha: bad BDF font bounding box")
+			}
+			f = &Font{width: fw, height: fh}
+		case "STARTCHAR":
+			enc, bw, bh, bx, by = -1, 0, 0, 0, 0
+		case "ENCODING":
+			v, err := ints(fields, 1)
+			if err != nil {
+				return nil, err
+			}
+			enc = v[0]
+		case "BBX":
+			v, err := ints(fields, 4)
+			if err != nil {
+				return nil, err
+			}
+			bw, bh, bx, by = v[0], v[1], v[2], v[3]
+		case "BITMAP":
+			if f == nil {
+				return nil, errors.New("captcha: BDF font has no bounding box")
+			}
+			g = nil
+			if 0 <= enc && enc < len(f.glyphs) {
+				g = make([]byte, fw*fh)
+			}
+			row = 0
+		case "ENDCHAR":
+			if g != nil {
+				f.glyphs[enc] = g
+			}
+			g, row = nil, -1
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return nil, errNoGlyphs
+	}
+	return f.trim()
+}
+
+// trim removes empty rows and columns around glyphs of the font, keeping
+// glyphs aligned with each other, and checks its size.
+func (f *Font) trim() (*Font, error) {
+	minx, miny, maxx, maxy := f.width, f.height, -1, -1
+	for _, g := range f.glyphs {
+		for i, v := range g {
+			if v != blackChar {
+				continue
+			}
+			x, y := i%f.width, i/f.width
+			minx, maxx = minInt(minx, x), maxInt(maxx, x)
+			miny, maxy = minInt(miny, y), maxInt(maxy, y)
+		}
+	}
+	if maxx < 0 {
+		return nil, errNoGlyphs
+	}
+	t := &Font{width: maxx - minx + 1, height: maxy - miny + 1}
+	if t.width > MaxFontSize || t.height > MaxFontSize {
+		return nil, errors.New("captcha: font is too large")
+	}
+	for c, g := range f.glyphs {
+		if g == nil {
+			continue
+		}
+		tg := make([]byte, t.width*t.height)
+		for y := 0; y < t.height; y++ {
+			copy(tg[y*t.width:(y+1)*t.width], g[(y+miny)*f.width+minx:])
+		}
+		t.glyphs[c] = tg
+	}
+	return t, nil
+}
+
+func maxInt(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
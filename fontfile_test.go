@@ -0,0 +1,157 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+const testBDF = `STARTFONT 2.1
+FONT -test-fixed
+SIZE 8 75 75
+FONTBOUNDINGBOX 8 10 0 -2
+CHARS 2
+STARTCHAR one
+ENCODING 49
+SWIDTH 500 0
+DWIDTH 8 0
+BBX 3 7 2 0
+BITMAP
+40
+C0
+40
+40
+40
+40
+E0
+ENDCHAR
+STARTCHAR seven
+ENCODING 55
+SWIDTH 500 0
+DWIDTH 8 0
+BBX 5 7 1 0
+BITMAP
+F8
+08
+10
+20
+40
+40
+40
+ENDCHAR
+ENDFONT
+`
+
+func fontString(f *Font, c byte) string {
+	var s []byte
+	for y := 0; y < f.height; y++ {
+		for x := 0; x < f.width; x++ {
+			if f.Dot(c, x, y) {
+				s = append(s, '#')
+			} else {
+				s = append(s, '.')
+			}
+		}
+		s = append(s, '\n')
+	}
+	return string(s)
+}
+
+func TestLoadFontBDF(t *testing.T) {
+	f, err := LoadFontBDF(strings.NewReader(testBDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Width() != 5 || f.Height() != 7 {
+		t.Fatalf("expected 5x7 font, got %dx%d", f.Width(), f.Height())
+	}
+	if f.Chars() != "17" {
+		t.Errorf("expected glyphs of \"17\", got %q", f.Chars())
+	}
+	// Glyphs are aligned by their bounding boxes.
+	one := "..#..\n" +
+		".##..\n" +
+		"..#..\n" +
+		"..#..\n" +
+		"..#..\n" +
+		"..#..\n" +
+		".###.\n"
+	if s := fontString(f, '1'); s != one {
+		t.Errorf("wrong glyph of 1:\n%s", s)
+	}
+	if _, err := LoadFontBDF(strings.NewReader("STARTFONT 2.1\nENDFONT\n")); err == nil {
+		t.Errorf("expected error for font without glyphs")
+	}
+}
+
+func TestLoadFontPNG(t *testing.T) {
+	// Two 6x8 cells with a 4x6 frame and a vertical bar.
+	img := image.NewNRGBA(image.Rect(0, 0, 12, 8))
+	for x := 1; x < 5; x++ {
+		img.Set(x, 1, color.Black)
+		img.Set(x, 6, color.Black)
+	}
+	for y := 1; y < 7; y++ {
+		img.Set(1, y, color.Black)
+		img.Set(4, y, color.Black)
+		img.Set(8, y, color.Black)
+	}
+	// Light pixels are not dots.
+	img.Set(2, 3, color.Gray{0xee})
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	f, err := LoadFontPNG(&buf, "0I")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Width() != 4 || f.Height() != 6 {
+		t.Fatalf("expected 4x6 font, got %dx%d", f.Width(), f.Height())
+	}
+	if s := fontString(f, 'I'); s != ".#..\n.#..\n.#..\n.#..\n.#..\n.#..\n" {
+		t.Errorf("wrong glyph of I:\n%s", s)
+	}
+	if s := fontString(f, '0'); s != "####\n#..#\n#..#\n#..#\n#..#\n####\n" {
+		t.Errorf("wrong glyph of 0:\n%s", s)
+	}
+	if _, err := NewFontFromImage(img, "01234"); err == nil {
+		t.Errorf("expected error for bad number of characters")
+	}
+}
+
+func TestImageFonts(t *testing.T) {
+	f, err := LoadFontBDF(strings.NewReader(testBDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultImage
+	opts.Fonts = []*Font{f}
+	m := new(Image)
+	m.opts = opts
+	fonts := m.chooseFonts([]byte("1729"))
+	if fonts[0] != f || fonts[1] != f || fonts[2] != DefaultFont || fonts[3] != DefaultFont {
+		t.Errorf("wrong fonts chosen")
+	}
+	if m.cellWidth != fontWidth || m.cellHeight != fontHeight {
+		t.Errorf("cell size doesn't fit the largest font")
+	}
+	// Fonts of characters are chosen randomly.
+	opts.Fonts = []*Font{DefaultFont, f}
+	m.opts = opts
+	counts := make(map[*Font]int)
+	for _, f := range m.chooseFonts(bytes.Repeat([]byte("1"), 100)) {
+		counts[f]++
+	}
+	if counts[f] == 0 || counts[DefaultFont] == 0 {
+		t.Errorf("fonts are not chosen randomly: %v", counts)
+	}
+	mgr := NewManager(Config{ImageOptions: &opts})
+	mgr.NewImage("id", []byte{1, 7, 2, 9}, StdWidth, StdHeight)
+	mgr.NewSVGImage("id", []byte{1, 7, 2, 9}, StdWidth, StdHeight)
+}
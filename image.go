@@ -6,77 +6,315 @@ package captcha
 
 import (
 	"bytes"
+	"errors"
 	"image"
 	"image/color"
 	"image/png"
 	"io"
 	"math"
+	"math/rand"
 )
 
 const (
 	// Standard width and height of a captcha image.
 	StdWidth  = 240
 	StdHeight = 80
-	// Maximum absolute skew factor of a single digit.
-	maxSkew = 0.7
-	// Number of background circles.
+	// Number of colors of background circles.
 	circleCount = 20
 )
 
+// ImageOptions control how captcha images are drawn, and therefore how hard
+// they are to solve, both for humans and computers.
+type ImageOptions struct {
+	// MaxSkew is the maximum absolute skew factor of a single digit.
+	MaxSkew float64
+	// Circles is the number of random noise circles.
+	Circles int
+	// CircleRadius is the maximum radius of noise circles relative to the
+	// size of dots that digits are made of.
+	CircleRadius float64
+	// MinDistortion and MaxDistortion are the range of amplitude of the
+	// wave distortion in pixels.
+	MinDistortion float64
+	MaxDistortion float64
+	// StrikeLines is the number of strike-through lines, and
+	// MaxStrikeAmplitude is the maximum amplitude of their waves in pixels.
+	StrikeLines        int
+	MaxStrikeAmplitude float64
+	// Border is the part of the smaller side of the image kept free
+	// around digits, from 0 to 0.5 (exclusive).
+	Border float64
+	// Centered places digits in the center of the image instead of at a
+	// random position.
+	Centered bool
+	// Palette describes colors of images. The zero value draws random
+	// dark colors on a transparent background.
+	Palette Palette
+	// Fonts are the fonts that characters are drawn with: the font of
+	// each character is chosen randomly among the fonts that have its
+	// glyph. Characters without glyphs in any of them are drawn with
+	// DefaultFont. Defaults to DefaultFont.
+	Fonts []*Font
+	// Renderer, if not nil, draws characters instead of the dot-matrix
+	// fonts. Strike-through lines, distortion and noise are still added.
+	// Renderers are not used for SVG images.
+	Renderer CharRenderer
+}
+
+// CharRenderer draws characters of captcha images. See the ttf subpackage
+// for a renderer of TrueType and OpenType fonts.
+type CharRenderer interface {
+	// DrawChars draws the characters on the image with color index 1.
+	// Characters are digits, uppercase Latin letters, or operators '+',
+	// '-', '*' (for ×) and '='. All random choices must be made with rng,
+	// so that images of the same captcha are the same.
+	DrawChars(m *image.Paletted, chars []byte, rng *rand.Rand)
+}
+
+// Presets of image options.
+var (
+	// EasyImage draws straight, centered digits with little noise.
+	EasyImage = ImageOptions{
+		MaxSkew:            0.3,
+		Circles:            8,
+		CircleRadius:       0.5,
+		MinDistortion:      2,
+		MaxDistortion:      5,
+		StrikeLines:        0,
+		MaxStrikeAmplitude: 10,
+		Border:             0.25,
+		Centered:           true,
+	}
+	// DefaultImage is used unless other options are configured.
+	DefaultImage = ImageOptions{
+		MaxSkew:            0.7,
+		Circles:            circleCount,
+		CircleRadius:       1,
+		MinDistortion:      5,
+		MaxDistortion:      10,
+		StrikeLines:        1,
+		MaxStrikeAmplitude: 20,
+		Border:             0.25,
+	}
+	// HardImage draws more skewed and distorted digits with more noise.
+	HardImage = ImageOptions{
+		MaxSkew:            1,
+		Circles:            40,
+		CircleRadius:       1.5,
+		MinDistortion:      8,
+		MaxDistortion:      14,
+		StrikeLines:        2,
+		MaxStrikeAmplitude: 25,
+		Border:             0.2,
+	}
+)
+
+// validate returns an error if options are invalid.
+func (o *ImageOptions) validate() error {
+	switch {
+	case o.MaxSkew < 0:
+		return errors.New("captcha: negative skew")
+	case o.Circles < 0 || o.CircleRadius < 0:
+		return errors.New("captcha: negative number or radius of circles")
+	case o.MinDistortion < 0 || o.MinDistortion > o.MaxDistortion:
+		return errors.New("captcha: bad range of distortion")
+	case o.StrikeLines < 0 || o.MaxStrikeAmplitude < 0:
+		return errors.New("captcha: negative number or amplitude of strike-through lines")
+	case o.Border < 0 || o.Border >= 0.5:
+		return errors.New("captcha: border must be in range [0, 0.5)")
+	}
+	for _, f := range o.Fonts {
+		if f == nil {
+			return errors.New("captcha: nil font")
+		}
+	}
+	return o.Palette.validate()
+}
+
 type Image struct {
 	*image.Paletted
 	numWidth  int
 	numHeight int
 	dotSize   int
-	rng       siprng
+	// cellWidth and cellHeight are the largest width and height of
+	// glyphs in dots.
+	cellWidth  int
+	cellHeight int
+	rng        siprng
+	opts       ImageOptions
+	glyphs     []GlyphBox
+}
+
+// GlyphBox describes where a character is drawn on a captcha image. Boxes
+// can be used as ground truth labels when training and evaluating OCR.
+type GlyphBox struct {
+	// Char is the character, such as '7', 'A' or '+'.
+	Char byte
+	// Bounds is the bounding box of the character's dots before the wave
+	// distortion.
+	Bounds image.Rectangle
+	// Skew is the horizontal shift of each row of dots relative to the
+	// previous one in pixels.
+	Skew float64
+	// Polygon is the outline of Bounds after the wave distortion.
+	Polygon []image.Point
+}
+
+// Glyphs returns boxes of characters in the order they are drawn. It returns
+// nil if characters were drawn by a CharRenderer.
+func (m *Image) Glyphs() []GlyphBox {
+	return m.glyphs
 }
 
 // NewImage returns a new captcha image of the given width and height with the
-// given digits, where each digit must be in range 0-9.
+// given digits, where each digit must be in range 0-9, or, if the default
+// alphabet is changed with SetAlphabet, an index of a character in it.
 func NewImage(id string, digits []byte, width, height int) *Image {
-	m := new(Image)
+	return defaultManager.NewImage(id, digits, width, height)
+}
+
+// NewImageWithOptions is like NewImage, but draws the image with the given
+// options, such as one of the presets EasyImage, DefaultImage or HardImage.
+// It panics if options are invalid.
+func NewImageWithOptions(id string, digits []byte, width, height int, opts ImageOptions) *Image {
+	return defaultManager.NewImageWithOptions(id, digits, width, height, opts)
+}
+
+// newImage returns a new captcha image with the given characters, drawn with
+// the given options and PRNG initialized from the given seed.
+func newImage(seed [16]byte, chars []byte, width, height int, opts ImageOptions) *Image {
+	m := &Image{opts: opts}
 
 	// Initialize PRNG.
-	m.rng.Seed(deriveSeed(imageSeedPurpose, id, digits))
+	m.rng.Seed(seed)
 
 	m.Paletted = image.NewPaletted(image.Rect(0, 0, width, height), m.getRandomPalette())
-	m.calculateSizes(width, height, len(digits))
-	// Randomly position captcha inside the image.
-	maxx := width - (m.numWidth+m.dotSize)*len(digits) - m.dotSize
-	maxy := height - m.numHeight - m.dotSize*2
-	var border int
-	if width > height {
-		border = height / 5
-	} else {
-		border = width / 5
-	}
-	x := m.rng.Int(border, maxx-border)
-	y := m.rng.Int(border, maxy-border)
-	// Draw digits.
-	for _, n := range digits {
-		m.drawDigit(font[n], x, y)
-		x += m.numWidth + m.dotSize
-	}
-	// Draw strike-through line.
+	m.drawChars(chars)
+	// Draw strike-through lines.
 	m.strikeThrough()
 	// Apply wave distortion.
-	m.distort(m.rng.Float(5, 10), m.rng.Float(100, 200))
+	m.distort(m.rng.Float(opts.MinDistortion, opts.MaxDistortion), m.rng.Float(100, 200))
 	// Fill image with random circles.
-	m.fillWithCircles(circleCount, m.dotSize)
+	m.fillWithCircles(opts.Circles, m.maxCircleRadius())
 	return m
 }
 
+// drawChars draws the characters at a random position inside the image.
+func (m *Image) drawChars(chars []byte) {
+	width := m.Bounds().Max.X
+	height := m.Bounds().Max.Y
+	if r := m.opts.Renderer; r != nil {
+		// Size noise as for the default font.
+		m.cellWidth, m.cellHeight = fontWidth, fontHeight
+		m.calculateSizes(width, height, len(chars))
+		r.DrawChars(m.Paletted, chars, rand.New(rand.NewSource(m.rng.Int63())))
+		return
+	}
+	fonts := m.chooseFonts(chars)
+	m.calculateSizes(width, height, len(chars))
+	// Randomly position captcha inside the image.
+	x, y := m.charsPosition(width, height, len(chars))
+	m.glyphs = make([]GlyphBox, len(chars))
+	for i, c := range chars {
+		bounds, skew := m.drawDigit(fonts[i], fonts[i].glyph(c), x, y)
+		m.glyphs[i] = GlyphBox{
+			Char:    c,
+			Bounds:  bounds,
+			Skew:    skew,
+			Polygon: rectPolygon(bounds),
+		}
+		x += m.numWidth + m.dotSize
+	}
+}
+
+// rectPolygon returns the outline of the rectangle, with each side divided
+// into several segments, so that it can be distorted.
+func rectPolygon(r image.Rectangle) []image.Point {
+	const n = 4 // segments per side
+	p := make([]image.Point, 0, 4*n)
+	for i := 0; i < n; i++ {
+		p = append(p, image.Pt(r.Min.X+r.Dx()*i/n, r.Min.Y))
+	}
+	for i := 0; i < n; i++ {
+		p = append(p, image.Pt(r.Max.X, r.Min.Y+r.Dy()*i/n))
+	}
+	for i := 0; i < n; i++ {
+		p = append(p, image.Pt(r.Max.X-r.Dx()*i/n, r.Max.Y))
+	}
+	for i := 0; i < n; i++ {
+		p = append(p, image.Pt(r.Min.X, r.Max.Y-r.Dy()*i/n))
+	}
+	return p
+}
+
+// chooseFonts returns randomly chosen fonts for the characters, and sets
+// cell sizes to fit their glyphs.
+func (m *Image) chooseFonts(chars []byte) []*Font {
+	fonts := make([]*Font, len(chars))
+	m.cellWidth, m.cellHeight = 0, 0
+	var candidates []*Font
+	for i, c := range chars {
+		candidates = candidates[:0]
+		for _, f := range m.opts.Fonts {
+			if f.glyph(c) != nil {
+				candidates = append(candidates, f)
+			}
+		}
+		switch len(candidates) {
+		case 0:
+			fonts[i] = DefaultFont
+		case 1:
+			fonts[i] = candidates[0]
+		default:
+			fonts[i] = candidates[m.rng.Intn(len(candidates))]
+		}
+		m.cellWidth = maxInt(m.cellWidth, fonts[i].width)
+		m.cellHeight = maxInt(m.cellHeight, fonts[i].height)
+	}
+	return fonts
+}
+
+// charsPosition returns the position of the top left corner of characters.
+func (m *Image) charsPosition(width, height, nchars int) (x, y int) {
+	maxx := width - (m.numWidth+m.dotSize)*nchars - m.dotSize
+	maxy := height - m.numHeight - m.dotSize*2
+	if m.opts.Centered {
+		return maxx / 2, maxy / 2
+	}
+	border := int(float64(minInt(width, height)) * m.opts.Border * 4 / 5)
+	x = m.randomOffset(maxx, border)
+	y = m.randomOffset(maxy, border)
+	return
+}
+
+// randomOffset returns a random offset in range [border, max-border]. If
+// characters fill the image, so that there is not enough room for the border,
+// it is made smaller.
+func (m *Image) randomOffset(max, border int) int {
+	if max < 2*border {
+		border = maxInt(max, 0) / 2
+	}
+	return m.rng.Int(border, maxInt(max-border, border))
+}
+
+// maxCircleRadius returns the maximum radius of noise circles.
+func (m *Image) maxCircleRadius() int {
+	r := int(float64(m.dotSize) * m.opts.CircleRadius)
+	if r < 1 {
+		r = 1
+	}
+	return r
+}
+
 func (m *Image) getRandomPalette() color.Palette {
 	p := make([]color.Color, circleCount+1)
-	// Transparent color.
+	// Background color, transparent by default.
 	p[0] = color.RGBA{0xFF, 0xFF, 0xFF, 0x00}
-	// Primary color.
-	prim := color.RGBA{
-		uint8(m.rng.Intn(129)),
-		uint8(m.rng.Intn(129)),
-		uint8(m.rng.Intn(129)),
-		0xFF,
+	if bg := m.opts.Palette.Background; bg != nil {
+		p[0] = bg
 	}
+	// Primary color.
+	prim := m.opts.Palette.ink(&m.rng)
 	p[1] = prim
 	// Circle colors.
 	for i := 2; i <= circleCount; i++ {
@@ -103,18 +341,13 @@ func (m *Image) WriteTo(w io.Writer) (int64, error) {
 
 func (m *Image) calculateSizes(width, height, ncount int) {
 	// Goal: fit all digits inside the image.
-	var border int
-	if width > height {
-		border = height / 4
-	} else {
-		border = width / 4
-	}
+	border := int(float64(minInt(width, height)) * m.opts.Border)
 	// Convert everything to floats for calculations.
 	w := float64(width - border*2)
 	h := float64(height - border*2)
 	// fw takes into account 1-dot spacing between digits.
-	fw := float64(fontWidth + 1)
-	fh := float64(fontHeight)
+	fw := float64(m.cellWidth + 1)
+	fh := float64(m.cellHeight)
 	nc := float64(ncount)
 	// Calculate the width of a single digit taking into account only the
 	// width of the image.
@@ -181,16 +414,41 @@ func (m *Image) fillWithCircles(n, maxradius int) {
 	}
 }
 
+// strikeLine describes a strike-through sine curve.
+type strikeLine struct {
+	y         int
+	amplitude float64
+	period    float64
+}
+
+func (m *Image) randomStrikeLine() strikeLine {
+	maxy := m.Bounds().Max.Y
+	mina := 5.0
+	if m.opts.MaxStrikeAmplitude < mina {
+		mina = m.opts.MaxStrikeAmplitude
+	}
+	return strikeLine{
+		y:         m.rng.Int(maxy/3, maxy-maxy/3),
+		amplitude: m.rng.Float(mina, m.opts.MaxStrikeAmplitude),
+		period:    m.rng.Float(80, 180),
+	}
+}
+
 func (m *Image) strikeThrough() {
+	for i := 0; i < m.opts.StrikeLines; i++ {
+		m.drawStrikeLine(m.randomStrikeLine(), 0, 0)
+	}
+}
+
+// drawStrikeLine draws the strike-through curve shifted by the given number
+// of pixels along the curve and moved by dy pixels down.
+func (m *Image) drawStrikeLine(l strikeLine, shift float64, dy int) {
 	maxx := m.Bounds().Max.X
-	maxy := m.Bounds().Max.Y
-	y := m.rng.Int(maxy/3, maxy-maxy/3)
-	amplitude := m.rng.Float(5, 20)
-	period := m.rng.Float(80, 180)
-	dx := 2.0 * math.Pi / period
+	y := l.y + dy
+	dx := 2.0 * math.Pi / l.period
 	for x := 0; x < maxx; x++ {
-		xo := amplitude * math.Cos(float64(y)*dx)
-		yo := amplitude * math.Sin(float64(x)*dx)
+		xo := l.amplitude * math.Cos(float64(l.y)*dx)
+		yo := l.amplitude * math.Sin((float64(x)+shift)*dx)
 		for yn := 0; yn < m.dotSize; yn++ {
 			r := m.rng.Int(0, m.dotSize)
 			m.drawCircle(x+int(xo), y+int(yo)+(yn*m.dotSize), r/2, 1)
@@ -198,21 +456,54 @@ func (m *Image) strikeThrough() {
 	}
 }
 
-func (m *Image) drawDigit(digit []byte, x, y int) {
-	skf := m.rng.Float(-maxSkew, maxSkew)
-	xs := float64(x)
+// glyphDotSize returns the size of dots of glyphs of the font, which is the
+// largest multiple of the dot size that fits glyphs into cells.
+func (m *Image) glyphDotSize(f *Font) int {
+	return m.dotSize * minInt(m.cellWidth/f.width, m.cellHeight/f.height)
+}
+
+// drawDigit draws the glyph of the font centered in the cell at the given
+// position, and returns its bounding box and skew.
+func (m *Image) drawDigit(f *Font, digit []byte, x, y int) (bounds image.Rectangle, skew float64) {
+	x, y, skew = m.placeGlyph(f, x, y)
+	return m.drawDots(f, digit, x, y, skew, 0), skew
+}
+
+// placeGlyph returns the position of the top left dot of the glyph of the
+// font in the cell at the given position, moved randomly up or down, and
+// a random skew of the glyph.
+func (m *Image) placeGlyph(f *Font, x, y int) (gx, gy int, skew float64) {
+	gd := m.glyphDotSize(f)
+	x += (m.cellWidth*m.dotSize - f.width*gd) / 2
+	y += (m.cellHeight*m.dotSize - f.height*gd) / 2
+	skew = m.rng.Float(-m.opts.MaxSkew, m.opts.MaxSkew)
 	r := m.dotSize / 2
 	y += m.rng.Int(-r, r)
-	for yo := 0; yo < fontHeight; yo++ {
-		for xo := 0; xo < fontWidth; xo++ {
-			if digit[yo*fontWidth+xo] != blackChar {
+	return x, y, skew
+}
+
+// drawDots draws dots of the glyph at the given position with the given
+// skew, and returns their bounding box. If drop is not zero, each dot is
+// left out with probability 1/drop.
+func (m *Image) drawDots(f *Font, digit []byte, x, y int, skew float64, drop int) (bounds image.Rectangle) {
+	gd := m.glyphDotSize(f)
+	xs := float64(x)
+	for yo := 0; yo < f.height; yo++ {
+		for xo := 0; xo < f.width; xo++ {
+			if digit[yo*f.width+xo] != blackChar {
+				continue
+			}
+			if drop != 0 && m.rng.Intn(drop) == 0 {
 				continue
 			}
-			m.drawCircle(x+xo*m.dotSize, y+yo*m.dotSize, r, 1)
+			cx, cy := x+xo*gd, y+yo*gd
+			m.drawCircle(cx, cy, gd/2, 1)
+			bounds = bounds.Union(image.Rect(cx-gd/2, cy-gd/2, cx+gd/2+1, cy+gd/2+1))
 		}
-		xs += skf
+		xs += skew
 		x = int(xs)
 	}
+	return bounds.Intersect(m.Bounds())
 }
 
 func (m *Image) distort(amplude float64, period float64) {
@@ -231,12 +522,26 @@ func (m *Image) distort(amplude float64, period float64) {
 		}
 	}
 	m.Paletted = newm
+
+	// Move outlines of glyphs. Pixels are moved backwards, so the new
+	// position q of a point p satisfies q + offset(q) = p, which is found
+	// by iteration.
+	for _, g := range m.glyphs {
+		for i, p := range g.Polygon {
+			qx, qy := float64(p.X), float64(p.Y)
+			for j := 0; j < 4; j++ {
+				qx = float64(p.X) - amplude*math.Sin(qy*dx)
+				qy = float64(p.Y) - amplude*math.Cos(qx*dx)
+			}
+			g.Polygon[i] = image.Pt(int(math.Round(qx)), int(math.Round(qy)))
+		}
+	}
 }
 
 func (m *Image) randomBrightness(c color.RGBA, max uint8) color.RGBA {
 	minc := min3(c.R, c.G, c.B)
 	maxc := max3(c.R, c.G, c.B)
-	if maxc > max {
+	if maxc >= max {
 		return c
 	}
 	n := m.rng.Intn(int(max-maxc)) - int(minc)
@@ -248,6 +553,13 @@ func (m *Image) randomBrightness(c color.RGBA, max uint8) color.RGBA {
 	}
 }
 
+func minInt(x, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
+
 func min3(x, y, z uint8) (m uint8) {
 	m = x
 	if y < m {
@@ -4,7 +4,11 @@
 
 package captcha
 
-import "testing"
+import (
+	"bytes"
+	"image"
+	"testing"
+)
 
 type byteCounter struct {
 	n int64
@@ -15,6 +19,107 @@ func (bc *byteCounter) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
+func TestImageOptions(t *testing.T) {
+	for _, o := range []ImageOptions{EasyImage, DefaultImage, HardImage} {
+		if err := o.validate(); err != nil {
+			t.Errorf("preset %+v: %v", o, err)
+		}
+	}
+	bad := []ImageOptions{
+		{MaxSkew: -1},
+		{MinDistortion: 5, MaxDistortion: 1},
+		{Circles: -1},
+		{Border: 0.5},
+	}
+	for _, o := range bad {
+		if o.validate() == nil {
+			t.Errorf("invalid options %+v accepted", o)
+		}
+	}
+}
+
+func TestImageBorder(t *testing.T) {
+	m := NewManager(Config{})
+	for _, n := range []int{4, 6, 8} {
+		d := RandomDigits(n)
+		for i := 0; i < 50; i++ {
+			opts := DefaultImage
+			opts.Border = float64(i) / 100
+			for _, size := range [][2]int{{StdWidth, StdHeight}, {150, 50}, {100, 100}} {
+				img := m.NewImageWithOptions("id", d, size[0], size[1], opts)
+				opts.Centered = true
+				m.NewImageWithOptions("id", d, size[0], size[1], opts)
+				opts.Centered = false
+				if img.Bounds().Dx() != size[0] {
+					t.Fatalf("wrong image size")
+				}
+			}
+		}
+	}
+}
+
+func TestNewImageWithOptions(t *testing.T) {
+	m := NewManager(Config{})
+	d := RandomDigits(DefaultLen)
+	var b1, b2, b3 bytes.Buffer
+	m.NewImage("id", d, StdWidth, StdHeight).WriteTo(&b1)
+	m.NewImageWithOptions("id", d, StdWidth, StdHeight, DefaultImage).WriteTo(&b2)
+	if !bytes.Equal(b1.Bytes(), b2.Bytes()) {
+		t.Errorf("image with DefaultImage options differs from NewImage")
+	}
+	m.NewImageWithOptions("id", d, StdWidth, StdHeight, HardImage).WriteTo(&b3)
+	if bytes.Equal(b1.Bytes(), b3.Bytes()) {
+		t.Errorf("image with HardImage options is the same as default one")
+	}
+	// Manager's options are used by NewImage.
+	hm := NewManager(Config{Key: m.keys[0].key, ImageOptions: &HardImage})
+	b1.Reset()
+	hm.NewImage("id", d, StdWidth, StdHeight).WriteTo(&b1)
+	if !bytes.Equal(b1.Bytes(), b3.Bytes()) {
+		t.Errorf("manager doesn't use configured image options")
+	}
+}
+
+func TestImageGlyphs(t *testing.T) {
+	opts := DefaultImage
+	opts.Circles, opts.StrikeLines = 0, 0
+	chars := []byte("12+3=")
+	m := newImage([16]byte{1}, chars, StdWidth, StdHeight, opts)
+	glyphs := m.Glyphs()
+	if len(glyphs) != len(chars) {
+		t.Fatalf("expected %d glyphs, got %d", len(chars), len(glyphs))
+	}
+	// All dots must be inside of outlines of glyphs.
+	var outlines []image.Rectangle
+	for i, g := range glyphs {
+		if g.Char != chars[i] {
+			t.Errorf("glyph %d: expected char %c, got %c", i, chars[i], g.Char)
+		}
+		if g.Bounds.Empty() || !g.Bounds.In(m.Bounds()) {
+			t.Errorf("glyph %d: bad bounds %v", i, g.Bounds)
+		}
+		var r image.Rectangle
+		for _, p := range g.Polygon {
+			r = r.Union(image.Rectangle{p, p.Add(image.Pt(1, 1))})
+		}
+		outlines = append(outlines, r.Inset(-2))
+	}
+	for y := 0; y < StdHeight; y++ {
+		for x := 0; x < StdWidth; x++ {
+			if m.ColorIndexAt(x, y) != 1 {
+				continue
+			}
+			inside := false
+			for _, r := range outlines {
+				inside = inside || image.Pt(x, y).In(r)
+			}
+			if !inside {
+				t.Fatalf("dot at (%d, %d) is outside of glyphs", x, y)
+			}
+		}
+	}
+}
+
 func BenchmarkNewImage(b *testing.B) {
 	b.StopTimer()
 	d := RandomDigits(DefaultLen)
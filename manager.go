@@ -0,0 +1,653 @@
+// Copyright 2011 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Config describes the configuration of a Manager. Zero values of fields are
+// replaced with package defaults.
+type Config struct {
+	// Store is a storage for captcha ids and solutions. If nil, a new
+	// memory store with CollectNum and Expiration is used. Stores
+	// implementing Store interface can be wrapped with WrapStore.
+	Store StoreContext
+	// Key is a secret key used to render images and audio. It must be at
+	// least MinKeyLen bytes long. If nil, a random key is generated. See
+	// SetKey for details.
+	Key []byte
+	// PreviousKeys are the keys that were used before Key, most recent
+	// first. Captchas created with them keep their representations.
+	PreviousKeys [][]byte
+	// DefaultLen is the number of digits in captcha solutions created by
+	// New. Defaults to DefaultLen.
+	DefaultLen int
+	// ImageWidth and ImageHeight are the dimensions of images served by
+	// Server. Default to StdWidth and StdHeight.
+	ImageWidth  int
+	ImageHeight int
+	// Lang is the language of audio captchas used when no language is
+	// requested. Defaults to "en".
+	Lang string
+	// Expiration is the expiration time of captchas passed to the store.
+	// If zero, the store's default expiration time is used; tokens expire
+	// after Expiration.
+	Expiration time.Duration
+	// Alphabet is the alphabet of captcha solutions. Defaults to
+	// DigitAlphabet.
+	Alphabet *Alphabet
+	// Arithmetic describes arithmetic challenges created by NewArithmetic.
+	Arithmetic Arithmetic
+	// ImageOptions control how images are drawn. Defaults to DefaultImage.
+	ImageOptions *ImageOptions
+	// AudioOptions describe the format of audio. Defaults to
+	// DefaultAudio.
+	AudioOptions *AudioOptions
+	// MaxAttempts is the number of attempts to solve a captcha before it
+	// is deleted. Defaults to 1. Stores must implement AttemptStore to
+	// allow more than one attempt.
+	MaxAttempts int
+}
+
+// Manager creates, verifies and renders captchas using its own store and
+// secret key. Package-level functions use the default Manager, so programs
+// that need only one configuration don't have to create it.
+type Manager struct {
+	store       StoreContext
+	keys        []secretKey // current key first
+	defaultLen  int
+	imgWidth    int
+	imgHeight   int
+	imgOpts     ImageOptions
+	audioOpts   AudioOptions
+	lang        string
+	alphabet    *Alphabet
+	arithmetic  Arithmetic
+	expiration  time.Duration
+	maxAttempts int
+	spent       spentTokens
+}
+
+// defaultManager is used by package-level functions.
+var defaultManager = NewManager(Config{})
+
+// NewManager returns a new Manager with the given configuration. It panics if
+// any of the configured keys are shorter than MinKeyLen or have the same id
+// tag (see SetKey), or arithmetic challenge settings, image or audio options
+// are invalid.
+func NewManager(c Config) *Manager {
+	m := new(Manager)
+	m.keys = newKeyring(c.Key, c.PreviousKeys)
+	m.expiration = c.Expiration
+	m.store = c.Store
+	if m.store == nil {
+		exp := m.expiration
+		if exp == 0 {
+			exp = Expiration
+		}
+		m.store = WrapStore(NewMemoryStore(CollectNum, exp))
+	}
+	m.defaultLen = c.DefaultLen
+	if m.defaultLen == 0 {
+		m.defaultLen = DefaultLen
+	}
+	m.imgWidth, m.imgHeight = c.ImageWidth, c.ImageHeight
+	if m.imgWidth == 0 {
+		m.imgWidth = StdWidth
+	}
+	if m.imgHeight == 0 {
+		m.imgHeight = StdHeight
+	}
+	m.imgOpts = DefaultImage
+	if c.ImageOptions != nil {
+		if err := c.ImageOptions.validate(); err != nil {
+			panic(err)
+		}
+		m.imgOpts = *c.ImageOptions
+	}
+	m.audioOpts = DefaultAudio
+	if c.AudioOptions != nil {
+		if err := c.AudioOptions.validate(); err != nil {
+			panic(err)
+		}
+		m.audioOpts = *c.AudioOptions
+	}
+	m.lang = c.Lang
+	if m.lang == "" {
+		m.lang = "en"
+	}
+	m.alphabet = c.Alphabet
+	if m.alphabet == nil {
+		m.alphabet = DigitAlphabet
+	}
+	a, err := c.Arithmetic.withDefaults()
+	if err != nil {
+		panic(err)
+	}
+	m.arithmetic = a
+	m.maxAttempts = c.MaxAttempts
+	if m.maxAttempts == 0 {
+		m.maxAttempts = 1
+	}
+	return m
+}
+
+// New creates a new captcha with the default length, saves it in the store
+// and returns its id.
+func (m *Manager) New() string {
+	return m.NewLen(m.defaultLen)
+}
+
+// NewLen is just like New, but accepts length of a captcha solution as the
+// argument.
+func (m *Manager) NewLen(length int) (id string) {
+	id, _ = m.NewLenContext(context.Background(), length)
+	return
+}
+
+// NewLenContext is like NewLen, but accepts a context and returns an error if
+// the captcha can't be saved in the store.
+func (m *Manager) NewLenContext(ctx context.Context, length int) (id string, err error) {
+	return m.NewWithOptions(ctx, Options{Len: length})
+}
+
+// NewLenTTL is just like NewLen, but the created captcha expires after the
+// given ttl instead of the manager's expiration time.
+func (m *Manager) NewLenTTL(length int, ttl time.Duration) (id string) {
+	id, _ = m.NewWithOptions(context.Background(), Options{Len: length, TTL: ttl})
+	return
+}
+
+// Options describe a captcha created by NewWithOptions.
+type Options struct {
+	// Len is the number of digits in captcha solution. Defaults to the
+	// manager's default length.
+	Len int
+	// TTL is the expiration time of the captcha. Defaults to the
+	// manager's expiration time.
+	TTL time.Duration
+	// Arithmetic, if true, makes the captcha an arithmetic challenge
+	// described by the manager's configuration; Len is ignored.
+	// Arithmetic challenges require DigitAlphabet and sounds of operators
+	// for the manager's language (see RegisterOperators).
+	Arithmetic bool
+}
+
+// NewWithOptions creates a new captcha with the given options, saves it in
+// the store and returns its id. It returns an error if the captcha can't be
+// saved in the store.
+func (m *Manager) NewWithOptions(ctx context.Context, opts Options) (id string, err error) {
+	if opts.Len == 0 {
+		opts.Len = m.defaultLen
+	}
+	if opts.TTL == 0 {
+		opts.TTL = m.expiration
+	}
+	var solution []byte
+	if opts.Arithmetic {
+		if m.alphabet.chars != DigitAlphabet.chars {
+			return "", errArithmeticAlphabet
+		}
+		if !hasOperatorSounds(m.lang) {
+			return "", errArithmeticAudio
+		}
+		solution = m.arithmetic.newChallenge()
+	} else {
+		solution = m.alphabet.Random(opts.Len)
+	}
+	id = m.newId()
+	err = m.store.Set(ctx, id, solution, opts.TTL)
+	return
+}
+
+// NewArithmetic creates a new arithmetic challenge, saves it in the store and
+// returns its id. Images of the challenge show an expression, such as
+// "7 + 12 =", and the solution is the answer. It panics if the manager's
+// alphabet is not DigitAlphabet, or there are no sounds of operators for the
+// manager's language.
+//
+// Built-in voices have no sounds of operators, so they must be registered
+// for the language with RegisterOperators or RegisterVoiceFS before
+// arithmetic challenges can be created.
+func (m *Manager) NewArithmetic() (id string) {
+	id, err := m.NewWithOptions(context.Background(), Options{Arithmetic: true})
+	if err == errArithmeticAlphabet || err == errArithmeticAudio {
+		panic(err)
+	}
+	return
+}
+
+// Reload generates and remembers new digits for the given captcha id.  This
+// function returns false if there is no captcha with the given id.
+func (m *Manager) Reload(id string) bool {
+	return m.ReloadContext(context.Background(), id) == nil
+}
+
+// ReloadContext is like Reload, but accepts a context and returns ErrNotFound
+// if there is no captcha with the given id, or other error returned by the
+// store.
+//
+// The reloaded captcha expires at the same time as before if the store
+// implements TTLStore. Otherwise, as the store doesn't report the remaining
+// time of captchas, it gets the manager's expiration time, even if it was
+// created with a different one.
+func (m *Manager) ReloadContext(ctx context.Context, id string) error {
+	old, err := m.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	ttl := m.expiration
+	if ts, ok := m.store.(TTLStore); ok {
+		if ttl, err = ts.TTL(ctx, id); err != nil {
+			return err
+		}
+	}
+	var solution []byte
+	if expr, _ := splitChallenge(old); expr != nil {
+		solution = m.arithmetic.newChallenge()
+	} else {
+		solution = m.alphabet.Random(len(old))
+	}
+	return m.store.Set(ctx, id, solution, ttl)
+}
+
+// digits returns the solution of the captcha with the given id or token.
+func (m *Manager) digits(ctx context.Context, id string) ([]byte, error) {
+	if isToken(id) {
+		if _, _, d, err := m.openToken(id, time.Now()); err == nil {
+			return d, nil
+		}
+	}
+	return m.store.Get(ctx, id)
+}
+
+// renderedChars returns characters of the solution to render, or, for
+// arithmetic challenges, characters of the expression.
+func (m *Manager) renderedChars(solution []byte) []byte {
+	expr, _ := splitChallenge(solution)
+	if expr == nil {
+		return []byte(m.alphabet.Format(solution))
+	}
+	chars := make([]byte, len(expr))
+	for i, n := range expr {
+		if n >= opPlus {
+			chars[i] = opChars[n-opPlus]
+		} else {
+			chars[i] = '0' + n
+		}
+	}
+	return chars
+}
+
+// speechLang returns the language in which the solution is pronounced:
+// the given one, or the manager's language if the solution is an arithmetic
+// challenge and there are no sounds of operators for the given language.
+// It returns ErrNoAudio if the solution can't be pronounced.
+func (m *Manager) speechLang(solution []byte, lang string) (string, error) {
+	if expr, _ := splitChallenge(solution); expr != nil {
+		if hasOperatorSounds(lang) {
+			return lang, nil
+		}
+		if hasOperatorSounds(m.lang) {
+			return m.lang, nil
+		}
+		return "", ErrNoAudio
+	}
+	if !m.alphabet.hasOnlyDigits() {
+		return "", ErrNoAudio
+	}
+	return lang, nil
+}
+
+// NewImage returns a new captcha image of the given width and height with the
+// given solution in the manager's alphabet, or the expression of the given
+// arithmetic challenge, rendered using the manager's secret key.
+func (m *Manager) NewImage(id string, digits []byte, width, height int) *Image {
+	return newImage(m.deriveSeed(imageSeedPurpose, id, digits), m.renderedChars(digits), width, height, m.imgOpts)
+}
+
+// NewImageWithOptions is like NewImage, but draws the image with the given
+// options instead of the manager's ones. It panics if options are invalid.
+func (m *Manager) NewImageWithOptions(id string, digits []byte, width, height int, opts ImageOptions) *Image {
+	if err := opts.validate(); err != nil {
+		panic(err)
+	}
+	return newImage(m.deriveSeed(imageSeedPurpose, id, digits), m.renderedChars(digits), width, height, opts)
+}
+
+// NewAnimatedImage returns a new animated captcha image of the given width and
+// height with the given solution, rendered using the manager's secret key.
+// See NewImage for details.
+func (m *Manager) NewAnimatedImage(id string, digits []byte, width, height int) *AnimatedImage {
+	return newAnimatedImage(m.deriveSeed(animationSeedPurpose, id, digits), m.renderedChars(digits), width, height, m.imgOpts)
+}
+
+// NewSVGImage returns a new vector captcha image of the given width and
+// height with the given solution, rendered using the manager's secret key.
+// See NewImage for details.
+func (m *Manager) NewSVGImage(id string, digits []byte, width, height int) *SVGImage {
+	return newSVGImage(m.deriveSeed(svgSeedPurpose, id, digits), m.renderedChars(digits), width, height, m.imgOpts)
+}
+
+// NewAudio returns a new audio captcha with the given solution in the
+// manager's alphabet, or the expression of the given arithmetic challenge,
+// rendered using the manager's secret key. Expressions are pronounced in the
+// manager's language if there are no sounds of operators for the given one.
+// It panics with ErrNoAudio if the alphabet contains characters other than
+// digits, as they can't be pronounced.
+func (m *Manager) NewAudio(id string, digits []byte, lang string) *Audio {
+	return m.newAudio(id, digits, lang, m.audioOpts)
+}
+
+// NewAudioWithOptions is like NewAudio, but encodes audio in the given
+// format instead of the manager's one. It panics if options are invalid.
+func (m *Manager) NewAudioWithOptions(id string, digits []byte, lang string, opts AudioOptions) *Audio {
+	if err := opts.validate(); err != nil {
+		panic(err)
+	}
+	return m.newAudio(id, digits, lang, opts)
+}
+
+func (m *Manager) newAudio(id string, digits []byte, lang string, opts AudioOptions) *Audio {
+	lang, err := m.speechLang(digits, lang)
+	if err != nil {
+		panic(err)
+	}
+	sounds := m.renderedChars(digits)
+	for i, c := range sounds {
+		if n := bytes.IndexByte(opChars[:], c); n >= 0 {
+			sounds[i] = opPlus + byte(n)
+		} else {
+			sounds[i] = c - '0'
+		}
+	}
+	return newAudio(m.deriveSeed(audioSeedPurpose, id, digits), sounds, lang, opts)
+}
+
+// WriteImage writes PNG-encoded image representation of the captcha with the
+// given id. The image will have the given width and height.
+func (m *Manager) WriteImage(w io.Writer, id string, width, height int) error {
+	return m.WriteImageContext(context.Background(), w, id, width, height)
+}
+
+// WriteImageContext is like WriteImage, but accepts a context. It returns
+// ErrNotFound if there is no captcha with the given id, or other error
+// returned by the store.
+func (m *Manager) WriteImageContext(ctx context.Context, w io.Writer, id string, width, height int) error {
+	d, err := m.digits(ctx, id)
+	if err != nil {
+		return err
+	}
+	_, err = m.NewImage(id, d, width, height).WriteTo(w)
+	return err
+}
+
+// WriteEncodedImage writes image representation of the captcha with the given
+// id encoded with the given encoder. The image will have the given width and
+// height.
+func (m *Manager) WriteEncodedImage(w io.Writer, id string, width, height int, e Encoder) error {
+	return m.WriteEncodedImageContext(context.Background(), w, id, width, height, e)
+}
+
+// WriteEncodedImageContext is like WriteEncodedImage, but accepts a context.
+// It returns ErrNotFound if there is no captcha with the given id, or other
+// error returned by the store.
+func (m *Manager) WriteEncodedImageContext(ctx context.Context, w io.Writer, id string, width, height int, e Encoder) error {
+	d, err := m.digits(ctx, id)
+	if err != nil {
+		return err
+	}
+	return e.Encode(w, m.NewImage(id, d, width, height))
+}
+
+// WriteAnimatedImage writes animated GIF-encoded image representation of the
+// captcha with the given id. The image will have the given width and height.
+func (m *Manager) WriteAnimatedImage(w io.Writer, id string, width, height int) error {
+	return m.WriteAnimatedImageContext(context.Background(), w, id, width, height)
+}
+
+// WriteAnimatedImageContext is like WriteAnimatedImage, but accepts a
+// context. It returns ErrNotFound if there is no captcha with the given id,
+// or other error returned by the store.
+func (m *Manager) WriteAnimatedImageContext(ctx context.Context, w io.Writer, id string, width, height int) error {
+	d, err := m.digits(ctx, id)
+	if err != nil {
+		return err
+	}
+	_, err = m.NewAnimatedImage(id, d, width, height).WriteTo(w)
+	return err
+}
+
+// WriteSVGImage writes SVG-encoded vector image representation of the
+// captcha with the given id. The image will have the given width and height.
+func (m *Manager) WriteSVGImage(w io.Writer, id string, width, height int) error {
+	return m.WriteSVGImageContext(context.Background(), w, id, width, height)
+}
+
+// WriteSVGImageContext is like WriteSVGImage, but accepts a context. It
+// returns ErrNotFound if there is no captcha with the given id, or other error
+// returned by the store.
+func (m *Manager) WriteSVGImageContext(ctx context.Context, w io.Writer, id string, width, height int) error {
+	d, err := m.digits(ctx, id)
+	if err != nil {
+		return err
+	}
+	_, err = m.NewSVGImage(id, d, width, height).WriteTo(w)
+	return err
+}
+
+// WriteAudio writes WAV-encoded audio representation of the captcha with the
+// given id and the given language. If lang is empty, the manager's default
+// language is used.
+func (m *Manager) WriteAudio(w io.Writer, id string, lang string) error {
+	return m.WriteAudioContext(context.Background(), w, id, lang)
+}
+
+// WriteAudioContext is like WriteAudio, but accepts a context. It returns
+// ErrNotFound if there is no captcha with the given id, ErrNoAudio if the
+// captcha can't be pronounced (see NewAudio), or other error returned by the
+// store.
+func (m *Manager) WriteAudioContext(ctx context.Context, w io.Writer, id string, lang string) error {
+	a, err := m.audio(ctx, id, lang)
+	if err != nil {
+		return err
+	}
+	_, err = a.WriteTo(w)
+	return err
+}
+
+// audio returns audio of the captcha with the given id in the given
+// language, or the manager's default language if lang is empty.
+func (m *Manager) audio(ctx context.Context, id string, lang string) (*Audio, error) {
+	d, err := m.digits(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if lang == "" {
+		lang = m.lang
+	}
+	if _, err := m.speechLang(d, lang); err != nil {
+		return nil, err
+	}
+	return m.NewAudio(id, d, lang), nil
+}
+
+// Result is the result of checking a captcha solution.
+type Result int
+
+const (
+	// ResultOK means the solution is correct. The captcha is deleted.
+	ResultOK Result = iota
+	// ResultWrong means the solution is wrong, but the captcha can be
+	// solved again.
+	ResultWrong
+	// ResultExhausted means the solution is wrong, and there are no
+	// attempts left. The captcha is deleted.
+	ResultExhausted
+	// ResultExpired means the captcha has expired.
+	ResultExpired
+	// ResultNotFound means there is no captcha with the given id.
+	ResultNotFound
+)
+
+var resultNames = [...]string{
+	ResultOK:        "ok",
+	ResultWrong:     "wrong",
+	ResultExhausted: "exhausted",
+	ResultExpired:   "expired",
+	ResultNotFound:  "not found",
+}
+
+func (r Result) String() string {
+	if r < 0 || int(r) >= len(resultNames) {
+		return "Result(" + strconv.Itoa(int(r)) + ")"
+	}
+	return resultNames[r]
+}
+
+// errResult converts an error returned by the store into a result. It
+// compares digits with dummy ones, so that checking missing captchas takes
+// as long as checking wrong solutions.
+func errResult(digits []byte, err error) (Result, error) {
+	equalDigits(digits, dummyDigits)
+	switch err {
+	case ErrNotFound:
+		return ResultNotFound, nil
+	case ErrExpired:
+		return ResultExpired, nil
+	}
+	return ResultNotFound, err
+}
+
+// Check checks whether the given digits are the solution of the captcha with
+// the given id, and tells why they are not.
+//
+// A captcha can be solved MaxAttempts times: wrong solutions are counted in
+// the store, and when there are no attempts left, the captcha is deleted and
+// ResultExhausted is returned. If the manager allows only one attempt, or the
+// store doesn't implement AttemptStore, the captcha is deleted after the first
+// attempt. Correctly solved captchas are always deleted. Empty solutions are
+// reported as ResultWrong and are not counted.
+//
+// Solutions are compared in constant time, and checking missing or expired
+// captchas does the same amount of work as checking wrong solutions, so the
+// time taken by Check doesn't reveal the solution. (Time taken by the store
+// is not under Check's control, though.)
+//
+// Errors returned by the store, other than ErrNotFound and ErrExpired, are
+// returned along with ResultNotFound.
+func (m *Manager) Check(ctx context.Context, id string, digits []byte) (Result, error) {
+	if len(digits) == 0 {
+		return ResultWrong, nil
+	}
+	as, ok := m.store.(AttemptStore)
+	if !ok || m.maxAttempts <= 1 {
+		reald, err := m.store.GetAndDelete(ctx, id)
+		if err != nil {
+			return errResult(digits, err)
+		}
+		if !equalDigits(digits, answerOf(reald)) {
+			return ResultExhausted, nil
+		}
+		return ResultOK, nil
+	}
+	reald, err := as.Get(ctx, id)
+	if err != nil {
+		return errResult(digits, err)
+	}
+	if equalDigits(digits, answerOf(reald)) {
+		// Delete the captcha, making sure that it has not been solved
+		// or reloaded by a concurrent request.
+		reald, err = as.GetAndDelete(ctx, id)
+		if err != nil {
+			return errResult(digits, err)
+		}
+		if !equalDigits(digits, answerOf(reald)) {
+			return ResultExhausted, nil
+		}
+		return ResultOK, nil
+	}
+	n, err := as.AddAttempt(ctx, id)
+	if err != nil {
+		return errResult(digits, err)
+	}
+	if n < m.maxAttempts {
+		return ResultWrong, nil
+	}
+	if err := as.Delete(ctx, id); err != nil {
+		return ResultNotFound, err
+	}
+	return ResultExhausted, nil
+}
+
+// CheckString is like Check, but accepts a string of characters. See
+// VerifyString for details. Strings containing invalid characters are reported as
+// ResultWrong and are not counted as attempts.
+func (m *Manager) CheckString(ctx context.Context, id string, digits string) (Result, error) {
+	ns, ok := m.alphabet.Parse(digits)
+	if !ok {
+		return ResultWrong, nil
+	}
+	return m.Check(ctx, id, ns)
+}
+
+// Verify returns true if the given digits are the ones that were used to
+// create the given captcha id.
+//
+// The function deletes the captcha with the given id from the store after it
+// has been solved, or after MaxAttempts wrong solutions, so that the same
+// captcha can't be verified anymore. Use Check to find out why verification
+// failed.
+func (m *Manager) Verify(id string, digits []byte) bool {
+	ok, _ := m.VerifyContext(context.Background(), id, digits)
+	return ok
+}
+
+// VerifyContext is like Verify, but accepts a context. It returns false and
+// ErrNotFound or ErrExpired if there is no captcha with the given id, or false
+// and other error returned by the store. Wrong solutions are reported as
+// false with nil error.
+func (m *Manager) VerifyContext(ctx context.Context, id string, digits []byte) (bool, error) {
+	r, err := m.Check(ctx, id, digits)
+	if err != nil {
+		return false, err
+	}
+	switch r {
+	case ResultNotFound:
+		return false, ErrNotFound
+	case ResultExpired:
+		return false, ErrExpired
+	}
+	return r == ResultOK, nil
+}
+
+// VerifyString is like Verify, but accepts a string of characters of the
+// manager's alphabet, which are compared case-insensitively. It removes
+// spaces and commas from the string, but any other characters, apart from
+// the alphabet's characters and listed above, will cause the function to
+// return false. If the alphabet was made with WithLookalikes, characters that
+// look like the alphabet's ones, such as O for 0, are accepted in their place.
+// See Alphabet.Parse for details.
+func (m *Manager) VerifyString(id string, digits string) bool {
+	ns, ok := m.alphabet.Parse(digits)
+	if !ok {
+		return false
+	}
+	return m.Verify(id, ns)
+}
+
+// Server returns a handler that serves HTTP requests with image or audio
+// representations of the manager's captchas. Images have the dimensions set
+// in the manager's configuration. See Server function documentation for
+// details.
+func (m *Manager) Server() http.Handler {
+	return &captchaHandler{m, m.imgWidth, m.imgHeight}
+}
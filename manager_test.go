@@ -0,0 +1,266 @@
+// Copyright 2011 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// getDigits returns digits stored for the captcha id, or nil.
+func getDigits(m *Manager, id string) []byte {
+	d, _ := m.store.Get(context.Background(), id)
+	return d
+}
+
+func TestManagerSeparateStores(t *testing.T) {
+	m1 := NewManager(Config{})
+	m2 := NewManager(Config{DefaultLen: 4})
+	id := m1.New()
+	if m2.Reload(id) {
+		t.Errorf("captcha from one manager found in another")
+	}
+	d := getDigits(m1, id) // cheating
+	if len(d) != DefaultLen {
+		t.Errorf("expected %d digits, got %d", DefaultLen, len(d))
+	}
+	if m2.Verify(id, d) {
+		t.Errorf("captcha from one manager verified by another")
+	}
+	if !m1.Verify(id, d) {
+		t.Errorf("proper captcha not verified")
+	}
+	id = m2.New()
+	if d := getDigits(m2, id); len(d) != 4 {
+		t.Errorf("expected 4 digits, got %d", len(d))
+	}
+}
+
+func TestManagerWriteImage(t *testing.T) {
+	m := NewManager(Config{})
+	id := m.New()
+	var b1, b2 bytes.Buffer
+	if err := m.WriteImage(&b1, id, StdWidth, StdHeight); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteImage(&b2, id, StdWidth, StdHeight); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b1.Bytes(), b2.Bytes()) {
+		t.Errorf("images for the same captcha differ")
+	}
+	if err := m.WriteImage(&b1, "nonexistent", StdWidth, StdHeight); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestManagerServer(t *testing.T) {
+	m := NewManager(Config{ImageWidth: 100, ImageHeight: 50})
+	id := m.New()
+	srv := m.Server()
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("GET", "/captcha/"+id+".png", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("expected image/png, got %q", ct)
+	}
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("GET", "/captcha/"+New()+".png", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("captcha from default manager served by another manager")
+	}
+}
+
+func TestManagerKey(t *testing.T) {
+	key1 := []byte("0123456789abcdef0123456789abcdef")
+	key2 := []byte("fedcba9876543210fedcba9876543210")
+	m1 := NewManager(Config{Key: key1})
+	m2 := NewManager(Config{Key: key1})
+	id := m1.New()
+	d := getDigits(m1, id) // cheating
+	var b1, b2 bytes.Buffer
+	m1.NewImage(id, d, StdWidth, StdHeight).WriteTo(&b1)
+	m2.NewImage(id, d, StdWidth, StdHeight).WriteTo(&b2)
+	if !bytes.Equal(b1.Bytes(), b2.Bytes()) {
+		t.Errorf("managers with the same key rendered different images")
+	}
+	// Rotate key: captchas created with key1 must keep their look.
+	m3 := NewManager(Config{Key: key2, PreviousKeys: [][]byte{key1}})
+	b2.Reset()
+	m3.NewImage(id, d, StdWidth, StdHeight).WriteTo(&b2)
+	if !bytes.Equal(b1.Bytes(), b2.Bytes()) {
+		t.Errorf("captcha created with previous key rendered differently")
+	}
+	if m3.newId()[0] != m3.keys[0].tag || m3.keyFor(m3.newId())[0] != key2[0] {
+		t.Errorf("new ids are not tagged with the current key")
+	}
+	m4 := NewManager(Config{Key: key2})
+	b2.Reset()
+	m4.NewImage(id, d, StdWidth, StdHeight).WriteTo(&b2)
+	if m4.keys[0].tag != m1.keys[0].tag && bytes.Equal(b1.Bytes(), b2.Bytes()) {
+		t.Errorf("managers with different keys rendered the same image")
+	}
+}
+
+func TestManagerKeyTagCollision(t *testing.T) {
+	// Find two keys with the same tag.
+	key1 := []byte("0123456789abcdef0123456789abcdef")
+	tag := newSecretKey(key1).tag
+	var key2 []byte
+	for i := 0; key2 == nil; i++ {
+		k := []byte(fmt.Sprintf("%032d", i))
+		if newSecretKey(k).tag == tag {
+			key2 = k
+		}
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected panic for keys with the same tag")
+			}
+		}()
+		NewManager(Config{Key: key2, PreviousKeys: [][]byte{key1}})
+	}()
+	// Random current key must get a tag different from previous keys.
+	for i := 0; i < 200; i++ {
+		m := NewManager(Config{PreviousKeys: [][]byte{key1}})
+		if m.keys[0].tag == tag {
+			t.Fatalf("random key has the same tag as previous key")
+		}
+		if !bytes.Equal(m.keyFor(string(tag)+"xxxx"), key1) {
+			t.Fatalf("id created with previous key didn't select it")
+		}
+	}
+}
+
+func TestManagerShortKey(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic for short key")
+		}
+	}()
+	NewManager(Config{Key: []byte("short")})
+}
+
+var errBrokenStore = errors.New("broken store")
+
+// brokenStore is a StoreContext that always fails.
+type brokenStore struct{}
+
+func (brokenStore) Set(ctx context.Context, id string, digits []byte, ttl time.Duration) error {
+	return errBrokenStore
+}
+
+func (brokenStore) Get(ctx context.Context, id string) ([]byte, error) {
+	return nil, errBrokenStore
+}
+
+func (brokenStore) GetAndDelete(ctx context.Context, id string) ([]byte, error) {
+	return nil, errBrokenStore
+}
+
+func (brokenStore) Delete(ctx context.Context, id string) error {
+	return errBrokenStore
+}
+
+func TestManagerStoreErrors(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(Config{})
+	if ok, err := m.VerifyContext(ctx, "nonexistent", []byte{1, 2, 3}); ok || err != ErrNotFound {
+		t.Errorf("expected false and ErrNotFound, got %v and %v", ok, err)
+	}
+	m = NewManager(Config{Store: brokenStore{}})
+	if _, err := m.NewLenContext(ctx, DefaultLen); err != errBrokenStore {
+		t.Errorf("NewLenContext: expected store error, got %v", err)
+	}
+	if ok, err := m.VerifyContext(ctx, "id", []byte{1, 2, 3}); ok || err != errBrokenStore {
+		t.Errorf("VerifyContext: expected false and store error, got %v and %v", ok, err)
+	}
+	if err := m.WriteImageContext(ctx, ioutil.Discard, "id", StdWidth, StdHeight); err != errBrokenStore {
+		t.Errorf("WriteImageContext: expected store error, got %v", err)
+	}
+	w := httptest.NewRecorder()
+	m.Server().ServeHTTP(w, httptest.NewRequest("GET", "/captcha/id.png", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", w.Code)
+	}
+}
+
+func TestManagerTTL(t *testing.T) {
+	m := NewManager(Config{})
+	id := m.NewLenTTL(4, time.Millisecond)
+	if d := getDigits(m, id); len(d) != 4 {
+		t.Fatalf("expected 4 digits, got %v", d)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if d := getDigits(m, id); d != nil {
+		t.Errorf("expired captcha returned")
+	}
+	id, err := m.NewWithOptions(context.Background(), Options{TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := getDigits(m, id); len(d) != DefaultLen {
+		t.Errorf("expected %d digits, got %v", DefaultLen, d)
+	}
+}
+
+func TestManagerAttempts(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(Config{MaxAttempts: 3})
+	id := m.New()
+	d := getDigits(m, id)
+	wrong := make([]byte, len(d))
+	copy(wrong, d)
+	wrong[0] = (wrong[0] + 1) % 10
+	for i, want := range []Result{ResultWrong, ResultWrong, ResultExhausted, ResultNotFound} {
+		if r, err := m.Check(ctx, id, wrong); r != want || err != nil {
+			t.Errorf("%d: expected %v, got %v, %v", i, want, r, err)
+		}
+	}
+	id = m.New()
+	d = getDigits(m, id)
+	if r, _ := m.CheckString(ctx, id, "x"); r != ResultWrong {
+		t.Errorf("invalid string: expected %v, got %v", ResultWrong, r)
+	}
+	m.Check(ctx, id, wrong)
+	if r, err := m.Check(ctx, id, d); r != ResultOK || err != nil {
+		t.Errorf("expected %v after wrong attempt, got %v, %v", ResultOK, r, err)
+	}
+	if r, _ := m.Check(ctx, id, d); r != ResultNotFound {
+		t.Errorf("solved captcha: expected %v, got %v", ResultNotFound, r)
+	}
+	// Reloading resets attempts, but not expiration time.
+	id = m.NewLenTTL(4, time.Hour)
+	m.Check(ctx, id, []byte{1})
+	m.Check(ctx, id, []byte{1})
+	m.Reload(id)
+	if r, _ := m.Check(ctx, id, []byte{1}); r != ResultWrong {
+		t.Errorf("reloaded captcha: expected %v, got %v", ResultWrong, r)
+	}
+	if ttl, _ := m.store.(TTLStore).TTL(ctx, id); ttl <= time.Hour-time.Minute || ttl > time.Hour {
+		t.Errorf("reloaded captcha: expected TTL of about an hour, got %v", ttl)
+	}
+	id = m.NewLenTTL(4, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	if r, _ := m.Check(ctx, id, []byte{1}); r != ResultExpired {
+		t.Errorf("expected %v, got %v", ResultExpired, r)
+	}
+	// Stores that don't count attempts allow only one.
+	m = NewManager(Config{MaxAttempts: 3, Store: WrapStore(NewLegacyStore(m.store, 0))})
+	id = m.New()
+	if r, _ := m.Check(ctx, id, []byte{1}); r != ResultExhausted {
+		t.Errorf("legacy store: expected %v, got %v", ResultExhausted, r)
+	}
+}
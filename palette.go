@@ -0,0 +1,134 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"errors"
+	"image/color"
+	"math"
+)
+
+// Palette describes colors of captcha images.
+type Palette struct {
+	// Foreground is the color of digits and strike-through lines. If nil,
+	// a random dark color is chosen for each image, or a random light one
+	// if Dark is true. Noise circles have random shades of it.
+	Foreground color.Color
+	// Background is the color of the background. If nil, the background
+	// is transparent.
+	Background color.Color
+	// Dark is true if images are shown on a dark background, so that they
+	// need light ink.
+	Dark bool
+	// MinContrast is the minimum contrast ratio between foreground and
+	// background colors, as defined by WCAG, from 1 to 21. If Background
+	// is nil, the contrast is checked against white, or black if Dark is
+	// true. Defaults to DefaultMinContrast.
+	MinContrast float64
+}
+
+// DefaultMinContrast is the default minimum contrast ratio between
+// foreground and background colors of images. It is the WCAG minimum for
+// large text.
+const DefaultMinContrast = 3
+
+// DarkPalette is a palette for sites with dark themes: digits are drawn with
+// random light colors on a transparent background.
+var DarkPalette = Palette{Dark: true, MinContrast: 4.5}
+
+// backdrop returns the color that the foreground is shown on.
+func (p *Palette) backdrop() color.Color {
+	switch {
+	case p.Background != nil:
+		return p.Background
+	case p.Dark:
+		return color.Black
+	default:
+		return color.White
+	}
+}
+
+func (p *Palette) minContrast() float64 {
+	if p.MinContrast == 0 {
+		return DefaultMinContrast
+	}
+	return p.MinContrast
+}
+
+// validate returns an error if the palette can't produce legible images.
+func (p *Palette) validate() error {
+	min := p.minContrast()
+	if min < 1 || min > 21 {
+		return errors.New("captcha: minimum contrast ratio must be in range [1, 21]")
+	}
+	bg := p.backdrop()
+	if p.Foreground != nil {
+		if ContrastRatio(p.Foreground, bg) < min {
+			return errors.New("captcha: contrast between foreground and background colors is too low")
+		}
+		return nil
+	}
+	// Random colors fall back to black or white.
+	if math.Max(ContrastRatio(color.Black, bg), ContrastRatio(color.White, bg)) < min {
+		return errors.New("captcha: no foreground color has enough contrast with background")
+	}
+	return nil
+}
+
+// maxInkTries is the number of random foreground colors tried before falling
+// back to black or white.
+const maxInkTries = 16
+
+// ink returns the foreground color, choosing a random one if it's not set.
+func (p *Palette) ink(rng *siprng) color.RGBA {
+	if p.Foreground != nil {
+		return color.RGBAModel.Convert(p.Foreground).(color.RGBA)
+	}
+	bg := p.backdrop()
+	min := p.minContrast()
+	for i := 0; i < maxInkTries; i++ {
+		c := color.RGBA{
+			uint8(rng.Intn(129)),
+			uint8(rng.Intn(129)),
+			uint8(rng.Intn(129)),
+			0xFF,
+		}
+		if p.Dark {
+			c.R, c.G, c.B = 255-c.R, 255-c.G, 255-c.B
+		}
+		if ContrastRatio(c, bg) >= min {
+			return c
+		}
+	}
+	if ContrastRatio(color.Black, bg) >= ContrastRatio(color.White, bg) {
+		return color.RGBA{0, 0, 0, 0xFF}
+	}
+	return color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+}
+
+// ContrastRatio returns the contrast ratio between two colors as defined by
+// WCAG, ranging from 1 for equal colors to 21 for black and white. Alpha is
+// ignored.
+func ContrastRatio(c1, c2 color.Color) float64 {
+	l1, l2 := relativeLuminance(c1), relativeLuminance(c2)
+	if l1 < l2 {
+		l1, l2 = l2, l1
+	}
+	return (l1 + 0.05) / (l2 + 0.05)
+}
+
+// relativeLuminance returns relative luminance of the color as defined by
+// WCAG.
+func relativeLuminance(c color.Color) float64 {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	linear := func(v uint8) float64 {
+		s := float64(v) / 255
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(n.R) + 0.7152*linear(n.G) + 0.0722*linear(n.B)
+}
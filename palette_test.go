@@ -0,0 +1,85 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestContrastRatio(t *testing.T) {
+	tests := []struct {
+		c1, c2 color.Color
+		ratio  float64
+	}{
+		{color.Black, color.White, 21},
+		{color.White, color.Black, 21},
+		{color.White, color.White, 1},
+		{color.RGBA{0x77, 0x77, 0x77, 0xff}, color.White, 4.48},
+	}
+	for _, test := range tests {
+		if r := ContrastRatio(test.c1, test.c2); math.Abs(r-test.ratio) > 0.01 {
+			t.Errorf("contrast of %v and %v: expected %.2f, got %.2f", test.c1, test.c2, test.ratio, r)
+		}
+	}
+}
+
+func TestPaletteValidate(t *testing.T) {
+	good := []Palette{
+		{},
+		DarkPalette,
+		{Foreground: color.White, Background: color.Black},
+		{Background: color.RGBA{0x20, 0x20, 0x30, 0xff}, Dark: true},
+	}
+	for _, p := range good {
+		if err := p.validate(); err != nil {
+			t.Errorf("%+v: %v", p, err)
+		}
+	}
+	bad := []Palette{
+		{Foreground: color.RGBA{0xee, 0xee, 0xee, 0xff}},
+		{Foreground: color.Black, Dark: true},
+		{Background: color.RGBA{0x77, 0x77, 0x77, 0xff}, MinContrast: 7},
+		{MinContrast: 22},
+	}
+	for _, p := range bad {
+		if p.validate() == nil {
+			t.Errorf("invalid palette %+v accepted", p)
+		}
+	}
+}
+
+func TestPaletteInk(t *testing.T) {
+	var rng siprng
+	rng.Seed([16]byte{1})
+	palettes := []Palette{
+		{},
+		DarkPalette,
+		{Background: color.RGBA{0x20, 0x20, 0x30, 0xff}, Dark: true, MinContrast: 7},
+		// Most random colors don't have enough contrast with gray.
+		{Background: color.RGBA{0x77, 0x77, 0x77, 0xff}, MinContrast: 4.6},
+	}
+	for _, p := range palettes {
+		for i := 0; i < 100; i++ {
+			if c := p.ink(&rng); ContrastRatio(c, p.backdrop()) < p.minContrast() {
+				t.Fatalf("%+v: low contrast of ink %v", p, c)
+			}
+		}
+	}
+}
+
+func TestImagePalette(t *testing.T) {
+	opts := DefaultImage
+	bg := color.RGBA{0x10, 0x20, 0x30, 0xff}
+	opts.Palette = Palette{Foreground: color.White, Background: bg}
+	img := NewImageWithOptions("id", RandomDigits(6), StdWidth, StdHeight, opts)
+	if img.Palette[0] != bg {
+		t.Errorf("expected background %v, got %v", bg, img.Palette[0])
+	}
+	if r, g, b, _ := img.Palette[1].RGBA(); r != 0xffff || g != 0xffff || b != 0xffff {
+		t.Errorf("expected white foreground, got %v", img.Palette[1])
+	}
+}
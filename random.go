@@ -5,6 +5,8 @@
 package captcha
 
 import (
+	"bytes"
+	"crypto/cipher"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -18,32 +20,134 @@ const idLen = 20
 // idChars are characters allowed in captcha id.
 var idChars = []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789")
 
-// rngKey is a secret key used to deterministically derive seeds for
-// PRNGs used in image and audio. Generated once during initialization.
-var rngKey [32]byte
-
-func init() {
-	if _, err := io.ReadFull(rand.Reader, rngKey[:]); err != nil {
-		panic("captcha: error reading random source: " + err.Error())
-	}
-}
-
 // Purposes for seed derivation. The goal is to make deterministic PRNG produce
 // different outputs for images and audio by using different derived seeds.
 const (
-	imageSeedPurpose = 0x01
-	audioSeedPurpose = 0x02
+	imageSeedPurpose     = 0x01
+	audioSeedPurpose     = 0x02
+	animationSeedPurpose = 0x03
+	svgSeedPurpose       = 0x04
 )
 
-// deriveSeed returns a 16-byte PRNG seed from rngKey, purpose, id and digits.
-// Same purpose, id and digits will result in the same derived seed for this
-// instance of running application.
+// MinKeyLen is the minimum length of a secret key accepted by SetKey and
+// NewManager.
+const MinKeyLen = 16
+
+// secretKey is a key used to deterministically derive seeds for PRNGs used in
+// image and audio, and to encrypt tokens.
+type secretKey struct {
+	key []byte
+	// tag is the first character of ids created while the key is current.
+	tag byte
+	// aead encrypts tokens.
+	aead cipher.AEAD
+}
+
+func newSecretKey(key []byte) secretKey {
+	if len(key) < MinKeyLen {
+		panic("captcha: secret key is too short")
+	}
+	k := secretKey{key: append([]byte(nil), key...)}
+	h := hmac.New(sha256.New, k.key)
+	io.WriteString(h, "captcha key tag")
+	k.tag = idChars[int(h.Sum(nil)[0])%len(idChars)]
+	k.aead = newTokenAEAD(k.key)
+	return k
+}
+
+// newKeyring returns secret keys made from the current key followed by the
+// previous ones. If current is nil, a random key with a tag different from
+// tags of the previous keys is generated. It panics if two different keys
+// have the same tag, since ids wouldn't tell which key they were created
+// with.
+func newKeyring(current []byte, previous [][]byte) []secretKey {
+	keys := make([]secretKey, 1, 1+len(previous))
+	for _, k := range previous {
+		sk := newSecretKey(k)
+		if hasTag(keys[1:], sk) {
+			panic(errKeyTag)
+		}
+		keys = append(keys, sk)
+	}
+	for {
+		key := current
+		if key == nil {
+			key = randomBytes(32)
+		}
+		keys[0] = newSecretKey(key)
+		if !hasTag(keys[1:], keys[0]) {
+			return keys
+		}
+		if current != nil {
+			panic(errKeyTag)
+		}
+	}
+}
+
+const errKeyTag = "captcha: keys have the same id tag, generate another key"
+
+// hasTag returns true if a key different from k has the same tag as k.
+func hasTag(keys []secretKey, k secretKey) bool {
+	for _, o := range keys {
+		if o.tag == k.tag && !bytes.Equal(o.key, k.key) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetKey sets the secret key used by the default manager to render images
+// and audio, replacing the random key generated during initialization. This
+// function must be called before generating any captchas.
+//
+// Applications running on several servers that share a store should set the
+// same key on all of them, so that every server renders the same
+// representations of a captcha. When the key is rotated, the old key should be
+// passed in previous until captchas created with it expire: ids of captchas
+// remember which key they were created with, so they keep their look. Ids
+// tell keys apart by a tag derived from each key; SetKey panics if a new key
+// has the same tag as one of the previous keys (about 1 in 62 chance per
+// previous key), in which case another key should be generated.
+func SetKey(key []byte, previous ...[]byte) {
+	defaultManager.keys = newKeyring(key, previous)
+}
+
+// newId returns a new random captcha id tagged with the current key.
+func (m *Manager) newId() string {
+	id := []byte(randomId())
+	id[0] = m.keys[0].tag
+	return string(id)
+}
+
+// keyFor returns the key to derive seeds for the captcha id: the most recent
+// key with the id's tag, or the current key if there's no such key. Tokens
+// are not tagged, so for them it is the key that the token was sealed with.
+func (m *Manager) keyFor(id string) []byte {
+	if isToken(id) {
+		if k, _, _ := m.tokenKey(id); k != nil {
+			return k.key
+		}
+		return m.keys[0].key
+	}
+	if id != "" {
+		for _, k := range m.keys {
+			if k.tag == id[0] {
+				return k.key
+			}
+		}
+	}
+	return m.keys[0].key
+}
+
+// deriveSeed returns a 16-byte PRNG seed from purpose, id and digits using the
+// manager's secret key selected for the id. Same purpose, id and digits will
+// result in the same derived seed for managers with the same keys.
 //
-//   out = HMAC(rngKey, purpose || id || 0x00 || digits)  (cut to 16 bytes)
+//   out = HMAC(key, purpose || id || 0x00 || digits)  (cut to 16 bytes)
 //
-func deriveSeed(purpose byte, id string, digits []byte) (out [16]byte) {
+func (m *Manager) deriveSeed(purpose byte, id string, digits []byte) (out [16]byte) {
 	var buf [sha256.Size]byte
-	h := hmac.New(sha256.New, rngKey[:])
+	h := hmac.New(sha256.New, m.keyFor(id))
 	h.Write([]byte{purpose})
 	io.WriteString(h, id)
 	h.Write([]byte{0})
@@ -0,0 +1,197 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package redisstore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Error is an error reply returned by the server.
+type Error string
+
+func (e Error) Error() string { return "redisstore: " + string(e) }
+
+var errProtocol = errors.New("redisstore: protocol error")
+
+// conn is a connection to a server speaking RESP protocol.
+type conn struct {
+	c net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+	// broken is set when the connection can't be reused.
+	broken bool
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{c: c, r: bufio.NewReader(c), w: bufio.NewWriter(c)}
+}
+
+// do sends a command with the given arguments and returns the reply, which
+// is nil, int64, string (for simple strings), []byte (for bulk strings) or
+// []interface{} (for arrays). Error replies are returned as Error.
+func (cn *conn) do(ctx context.Context, args ...[]byte) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	cn.c.SetDeadline(deadline)
+	if err := cn.writeCommand(args); err != nil {
+		cn.broken = true
+		return nil, err
+	}
+	v, err := cn.readReply()
+	if err != nil {
+		if _, ok := err.(Error); !ok {
+			cn.broken = true
+		}
+	}
+	return v, err
+}
+
+func (cn *conn) writeCommand(args [][]byte) error {
+	fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(cn.w, "$%d\r\n", len(a))
+		cn.w.Write(a)
+		cn.w.WriteString("\r\n")
+	}
+	return cn.w.Flush()
+}
+
+// readLine reads a line without the trailing CRLF.
+func (cn *conn) readLine() ([]byte, error) {
+	line, err := cn.r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errProtocol
+	}
+	return line[:len(line)-2], nil
+}
+
+func (cn *conn) readReply() (interface{}, error) {
+	line, err := cn.readLine()
+	if err != nil {
+		return nil, err
+	}
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(cn.r, b); err != nil {
+			return nil, err
+		}
+		if b[n] != '\r' || b[n+1] != '\n' {
+			return nil, errProtocol
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		a := make([]interface{}, n)
+		for i := range a {
+			// Errors inside arrays are returned as elements.
+			v, err := cn.readReply()
+			if e, ok := err.(Error); ok {
+				a[i] = e
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			a[i] = v
+		}
+		return a, nil
+	}
+	return nil, errProtocol
+}
+
+func (cn *conn) close() error {
+	return cn.c.Close()
+}
+
+// dial connects to the server and performs authentication and database
+// selection.
+func (s *Store) dial(ctx context.Context) (*conn, error) {
+	d := net.Dialer{Timeout: s.opts.DialTimeout}
+	c, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := newConn(c)
+	if s.opts.Password != "" {
+		if _, err := cn.do(ctx, []byte("AUTH"), []byte(s.opts.Password)); err != nil {
+			cn.close()
+			return nil, err
+		}
+	}
+	if s.opts.DB != 0 {
+		if _, err := cn.do(ctx, []byte("SELECT"), []byte(strconv.Itoa(s.opts.DB))); err != nil {
+			cn.close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// getConn returns an idle connection or dials a new one.
+func (s *Store) getConn(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-s.idle:
+		return cn, nil
+	default:
+		return s.dial(ctx)
+	}
+}
+
+// putConn returns the connection to the pool of idle connections or closes
+// it if it's broken or the pool is full.
+func (s *Store) putConn(cn *conn) {
+	if cn.broken {
+		cn.close()
+		return
+	}
+	cn.c.SetDeadline(time.Time{})
+	select {
+	case s.idle <- cn:
+	default:
+		cn.close()
+	}
+}
+
+// do sends a command using a connection from the pool.
+func (s *Store) do(ctx context.Context, args ...[]byte) (interface{}, error) {
+	cn, err := s.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.putConn(cn)
+	return cn.do(ctx, args...)
+}
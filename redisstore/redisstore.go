@@ -0,0 +1,210 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package redisstore implements a captcha store that keeps captchas in a
+// server speaking Redis protocol (RESP), such as Redis, Valkey or KeyDB.
+//
+// Captchas are saved with native expiration time, so there's no need to
+// collect expired captchas. Verification gets and deletes a captcha with a
+// single atomic GETDEL command (or, for servers that don't support it, a
+// script), so that the same captcha can't be verified twice by concurrent
+// requests to different web servers.
+//
+// Failed verification attempts are counted in a separate key (the captcha
+// key with ":attempts" suffix), which expires together with the captcha.
+// Redis deletes expired keys by itself, so the store reports
+// captcha.ErrNotFound rather than captcha.ErrExpired for expired captchas.
+//
+// The package includes a minimal protocol client and doesn't depend on
+// third-party packages.
+package redisstore
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/dchest/captcha"
+)
+
+// Options describe connection parameters of a store.
+type Options struct {
+	// Password, if not empty, is sent with AUTH command after connecting.
+	Password string
+	// DB, if not zero, is the number of database selected after
+	// connecting.
+	DB int
+	// Prefix is prepended to captcha ids to make keys. Defaults to
+	// "captcha:".
+	Prefix string
+	// MaxIdleConns is the maximum number of idle connections kept for
+	// reuse. Defaults to 4.
+	MaxIdleConns int
+	// DialTimeout is the timeout for connecting to the server. Zero means
+	// no timeout other than the one set by the context.
+	DialTimeout time.Duration
+}
+
+// Store is a captcha store that keeps captchas in a Redis server. It
+// implements captcha.AttemptStore and captcha.TTLStore interfaces; use
+// captcha.NewLegacyStore to get captcha.Store. Store is safe for concurrent
+// use by multiple goroutines.
+type Store struct {
+	addr string
+	opts Options
+	idle chan *conn
+	// noGetDel is set to 1 when the server doesn't support GETDEL.
+	noGetDel int32
+}
+
+// New returns a new store that connects to the server at the given TCP
+// address (for example, "localhost:6379"). Connections are established when
+// needed. If opts is nil, default options are used.
+func New(addr string, opts *Options) *Store {
+	s := &Store{addr: addr}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.Prefix == "" {
+		s.opts.Prefix = "captcha:"
+	}
+	if s.opts.MaxIdleConns == 0 {
+		s.opts.MaxIdleConns = 4
+	}
+	s.idle = make(chan *conn, s.opts.MaxIdleConns)
+	return s
+}
+
+// Close closes idle connections.
+func (s *Store) Close() error {
+	for {
+		select {
+		case cn := <-s.idle:
+			cn.close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (s *Store) key(id string) []byte {
+	return []byte(s.opts.Prefix + id)
+}
+
+func (s *Store) attemptsKey(id string) []byte {
+	return []byte(s.opts.Prefix + id + ":attempts")
+}
+
+// Set saves the digits for the captcha id, which expire after ttl, and resets
+// the number of failed attempts. If ttl is zero, captcha.Expiration is used.
+func (s *Store) Set(ctx context.Context, id string, digits []byte, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = captcha.Expiration
+	}
+	ms := int64(ttl / time.Millisecond)
+	if ms <= 0 {
+		// Already expired.
+		return s.Delete(ctx, id)
+	}
+	_, err := s.do(ctx, []byte("SET"), s.key(id), digits,
+		[]byte("PX"), []byte(strconv.FormatInt(ms, 10)))
+	if err != nil {
+		return err
+	}
+	_, err = s.do(ctx, []byte("DEL"), s.attemptsKey(id))
+	return err
+}
+
+// digitsReply converts a reply to GET-like command into digits.
+func digitsReply(v interface{}, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case nil:
+		return nil, captcha.ErrNotFound
+	case []byte:
+		return v, nil
+	}
+	return nil, errProtocol
+}
+
+// Get returns stored digits for the captcha id.
+func (s *Store) Get(ctx context.Context, id string) ([]byte, error) {
+	return digitsReply(s.do(ctx, []byte("GET"), s.key(id)))
+}
+
+// getDelScript is used to atomically get and delete a key on servers that
+// don't support GETDEL command (before Redis 6.2).
+const getDelScript = `local v = redis.call('GET', KEYS[1])
+if v then redis.call('DEL', KEYS[1]) end
+return v`
+
+// GetAndDelete returns stored digits for the captcha id and deletes it
+// atomically.
+func (s *Store) GetAndDelete(ctx context.Context, id string) ([]byte, error) {
+	if atomic.LoadInt32(&s.noGetDel) == 0 {
+		v, err := s.do(ctx, []byte("GETDEL"), s.key(id))
+		if e, ok := err.(Error); !ok || !isUnknownCommand(e) {
+			return digitsReply(v, err)
+		}
+		atomic.StoreInt32(&s.noGetDel, 1)
+	}
+	return digitsReply(s.do(ctx, []byte("EVAL"), []byte(getDelScript), []byte("1"), s.key(id)))
+}
+
+func isUnknownCommand(e Error) bool {
+	const prefix = "ERR unknown command"
+	return len(e) >= len(prefix) && string(e[:len(prefix)]) == prefix
+}
+
+// addAttemptScript increments the number of attempts stored in KEYS[2] and
+// makes it expire together with the captcha stored in KEYS[1]. It returns -1
+// if there's no captcha.
+const addAttemptScript = `local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then return -1 end
+local n = redis.call('INCR', KEYS[2])
+redis.call('PEXPIRE', KEYS[2], ttl)
+return n`
+
+// AddAttempt increments the number of failed verification attempts of the
+// captcha id and returns it.
+func (s *Store) AddAttempt(ctx context.Context, id string) (int, error) {
+	v, err := s.do(ctx, []byte("EVAL"), []byte(addAttemptScript), []byte("2"), s.key(id), s.attemptsKey(id))
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, errProtocol
+	}
+	if n < 0 {
+		return 0, captcha.ErrNotFound
+	}
+	return int(n), nil
+}
+
+// TTL returns the time left until the captcha id expires.
+func (s *Store) TTL(ctx context.Context, id string) (time.Duration, error) {
+	v, err := s.do(ctx, []byte("PTTL"), s.key(id))
+	if err != nil {
+		return 0, err
+	}
+	ms, ok := v.(int64)
+	if !ok {
+		return 0, errProtocol
+	}
+	if ms <= 0 {
+		// Missing (-2), or not set by Set (-1).
+		return 0, captcha.ErrNotFound
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Delete deletes the captcha with the given id.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	_, err := s.do(ctx, []byte("DEL"), s.key(id), s.attemptsKey(id))
+	return err
+}
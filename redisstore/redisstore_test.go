@@ -0,0 +1,373 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package redisstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dchest/captcha"
+)
+
+// fakeServer is an in-process stand-in for Redis server that supports
+// commands used by Store.
+type fakeServer struct {
+	ln       net.Listener
+	password string
+	noGetDel bool
+
+	mu       sync.Mutex
+	values   map[string][]byte
+	deadline map[string]time.Time
+	commands []string
+}
+
+// newFakeServer starts a new server that requires the given password, if
+// it's not empty, and doesn't support GETDEL command if noGetDel is true.
+func newFakeServer(t *testing.T, password string, noGetDel bool) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		ln:       ln,
+		password: password,
+		noGetDel: noGetDel,
+		values:   make(map[string][]byte),
+		deadline: make(map[string]time.Time),
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeServer) addr() string { return s.ln.Addr().String() }
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if line[0] != '*' {
+		return nil, fmt.Errorf("expected array, got %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		l, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, l+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:l])
+	}
+	return args, nil
+}
+
+func writeBulk(w io.Writer, v []byte) {
+	if v == nil {
+		io.WriteString(w, "$-1\r\n")
+		return
+	}
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+}
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authed := s.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		s.mu.Lock()
+		s.commands = append(s.commands, cmd)
+		if !authed && cmd != "AUTH" {
+			io.WriteString(c, "-NOAUTH Authentication required.\r\n")
+			s.mu.Unlock()
+			continue
+		}
+		switch cmd {
+		case "AUTH":
+			if args[1] != s.password {
+				io.WriteString(c, "-WRONGPASS invalid password\r\n")
+			} else {
+				authed = true
+				io.WriteString(c, "+OK\r\n")
+			}
+		case "SELECT":
+			io.WriteString(c, "+OK\r\n")
+		case "SET":
+			ms, _ := strconv.Atoi(args[4])
+			s.values[args[1]] = []byte(args[2])
+			s.deadline[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			io.WriteString(c, "+OK\r\n")
+		case "GET":
+			writeBulk(c, s.get(args[1]))
+		case "PTTL":
+			if s.get(args[1]) == nil {
+				io.WriteString(c, ":-2\r\n")
+				break
+			}
+			fmt.Fprintf(c, ":%d\r\n", time.Until(s.deadline[args[1]])/time.Millisecond)
+		case "GETDEL":
+			if s.noGetDel {
+				fmt.Fprintf(c, "-ERR unknown command '%s', with args beginning with:\r\n", args[0])
+				break
+			}
+			writeBulk(c, s.get(args[1]))
+			delete(s.values, args[1])
+		case "EVAL":
+			switch args[1] {
+			case getDelScript:
+				writeBulk(c, s.get(args[3]))
+				delete(s.values, args[3])
+			case addAttemptScript:
+				if s.get(args[3]) == nil {
+					io.WriteString(c, ":-1\r\n")
+					break
+				}
+				n := 0
+				if v := s.get(args[4]); v != nil {
+					n, _ = strconv.Atoi(string(v))
+				}
+				n++
+				s.values[args[4]] = []byte(strconv.Itoa(n))
+				s.deadline[args[4]] = s.deadline[args[3]]
+				fmt.Fprintf(c, ":%d\r\n", n)
+			default:
+				io.WriteString(c, "-ERR unknown script\r\n")
+			}
+		case "DEL":
+			n := 0
+			for _, k := range args[1:] {
+				if _, ok := s.values[k]; ok {
+					delete(s.values, k)
+					n++
+				}
+			}
+			fmt.Fprintf(c, ":%d\r\n", n)
+		default:
+			fmt.Fprintf(c, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		s.mu.Unlock()
+	}
+}
+
+// get returns the value of the key, or nil if it doesn't exist or expired.
+func (s *fakeServer) get(key string) []byte {
+	v, ok := s.values[key]
+	if !ok || time.Now().After(s.deadline[key]) {
+		return nil
+	}
+	return v
+}
+
+func TestSetGet(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t, "", false)
+	s := New(srv.addr(), nil)
+	defer s.Close()
+	d := captcha.RandomDigits(10)
+	if err := s.Set(ctx, "id", d, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	srv.mu.Lock()
+	if _, ok := srv.values["captcha:id"]; !ok {
+		t.Errorf("key is not prefixed")
+	}
+	srv.mu.Unlock()
+	d2, err := s.Get(ctx, "id")
+	if err != nil || !bytes.Equal(d, d2) {
+		t.Errorf("saved %v, Get returned %v, %v", d, d2, err)
+	}
+	d2, err = s.GetAndDelete(ctx, "id")
+	if err != nil || !bytes.Equal(d, d2) {
+		t.Errorf("saved %v, GetAndDelete returned %v, %v", d, d2, err)
+	}
+	if _, err := s.Get(ctx, "id"); err != captcha.ErrNotFound {
+		t.Errorf("GetAndDelete didn't delete: %v", err)
+	}
+	s.Set(ctx, "id", d, time.Minute)
+	if err := s.Delete(ctx, "id"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetAndDelete(ctx, "id"); err != captcha.ErrNotFound {
+		t.Errorf("Delete didn't delete: %v", err)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t, "", false)
+	s := New(srv.addr(), nil)
+	defer s.Close()
+	d := captcha.RandomDigits(10)
+	s.Set(ctx, "id", d, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, err := s.Get(ctx, "id"); err != captcha.ErrNotFound {
+		t.Errorf("expected ErrNotFound for expired captcha, got %v", err)
+	}
+	s.Set(ctx, "id", d, time.Minute)
+	if ttl, err := s.TTL(ctx, "id"); ttl <= 0 || ttl > time.Minute || err != nil {
+		t.Errorf("TTL: expected at most a minute, got %v, %v", ttl, err)
+	}
+	s.Set(ctx, "id", d, -1)
+	if _, err := s.Get(ctx, "id"); err != captcha.ErrNotFound {
+		t.Errorf("expected ErrNotFound for captcha with negative ttl, got %v", err)
+	}
+	if _, err := s.TTL(ctx, "id"); err != captcha.ErrNotFound {
+		t.Errorf("TTL: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestGetDelScript(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t, "", true)
+	s := New(srv.addr(), nil)
+	defer s.Close()
+	d := captcha.RandomDigits(10)
+	for i := 0; i < 2; i++ {
+		s.Set(ctx, "id", d, time.Minute)
+		d2, err := s.GetAndDelete(ctx, "id")
+		if err != nil || !bytes.Equal(d, d2) {
+			t.Errorf("%d: saved %v, GetAndDelete returned %v, %v", i, d, d2, err)
+		}
+		if _, err := s.Get(ctx, "id"); err != captcha.ErrNotFound {
+			t.Errorf("%d: GetAndDelete didn't delete: %v", i, err)
+		}
+	}
+	n := 0
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, c := range srv.commands {
+		if c == "GETDEL" {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("expected GETDEL to be tried once, tried %d times", n)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t, "secret", false)
+	s := New(srv.addr(), &Options{Password: "wrong"})
+	if err := s.Set(ctx, "id", []byte{1}, time.Minute); err == nil {
+		t.Errorf("expected error with wrong password")
+	}
+	s = New(srv.addr(), &Options{Password: "secret", DB: 2})
+	defer s.Close()
+	if err := s.Set(ctx, "id", []byte{1}, time.Minute); err != nil {
+		t.Errorf("Set: %v", err)
+	}
+}
+
+func TestConnectionError(t *testing.T) {
+	srv := newFakeServer(t, "", false)
+	addr := srv.addr()
+	srv.ln.Close()
+	s := New(addr, &Options{DialTimeout: time.Second})
+	if _, err := s.Get(context.Background(), "id"); err == nil || err == captcha.ErrNotFound {
+		t.Errorf("expected connection error, got %v", err)
+	}
+}
+
+func TestConcurrentVerify(t *testing.T) {
+	srv := newFakeServer(t, "", false)
+	s := New(srv.addr(), nil)
+	defer s.Close()
+	m := captcha.NewManager(captcha.Config{Store: s})
+	id := m.New()
+	d, err := s.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		ok int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if m.Verify(id, d) {
+				mu.Lock()
+				ok++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if ok != 1 {
+		t.Errorf("expected exactly one successful Verify, got %d", ok)
+	}
+}
+
+func TestAddAttempt(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t, "", false)
+	s := New(srv.addr(), nil)
+	defer s.Close()
+	d := captcha.RandomDigits(10)
+	s.Set(ctx, "id", d, time.Minute)
+	for i := 1; i <= 2; i++ {
+		if n, err := s.AddAttempt(ctx, "id"); n != i || err != nil {
+			t.Errorf("expected %d attempts, got %d, %v", i, n, err)
+		}
+	}
+	s.Set(ctx, "id", d, time.Minute)
+	if n, _ := s.AddAttempt(ctx, "id"); n != 1 {
+		t.Errorf("Set didn't reset attempts: got %d", n)
+	}
+	if _, err := s.AddAttempt(ctx, "nonexistent"); err != captcha.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	s.Delete(ctx, "id")
+	srv.mu.Lock()
+	if _, ok := srv.values["captcha:id:attempts"]; ok {
+		t.Errorf("Delete didn't delete attempts")
+	}
+	srv.mu.Unlock()
+	m := captcha.NewManager(captcha.Config{Store: s, MaxAttempts: 2})
+	id := m.New()
+	if r, _ := m.Check(ctx, id, []byte{1}); r != captcha.ResultWrong {
+		t.Errorf("expected %v, got %v", captcha.ResultWrong, r)
+	}
+	if r, _ := m.Check(ctx, id, []byte{1}); r != captcha.ResultExhausted {
+		t.Errorf("expected %v, got %v", captcha.ResultExhausted, r)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import "math"
+
+// Windowed-sinc resampling.
+const (
+	sincZeros      = 8   // number of zero crossings of sinc on each side
+	sincResolution = 256 // kernel table entries per zero crossing
+)
+
+// sincTable is the Blackman-windowed sinc kernel sampled from 0 to sincZeros.
+var sincTable = func() []float64 {
+	t := make([]float64, sincZeros*sincResolution+1)
+	for i := range t {
+		x := float64(i) / sincResolution
+		w := 0.42 + 0.5*math.Cos(math.Pi*x/sincZeros) + 0.08*math.Cos(2*math.Pi*x/sincZeros)
+		if i == 0 {
+			t[i] = 1
+		} else {
+			t[i] = math.Sin(math.Pi*x) / (math.Pi * x) * w
+		}
+	}
+	return t
+}()
+
+// resampler converts sounds to another sample rate with windowed-sinc
+// interpolation. When downsampling, the kernel is widened to filter out
+// frequencies that the new rate can't represent.
+type resampler struct {
+	step   float64 // distance between output samples in input samples
+	cutoff float64 // cutoff frequency relative to the input Nyquist frequency
+	width  float64 // half-width of the kernel in input samples
+
+	// If the ratio of rates is from/to in lowest terms with a small to,
+	// positions of output samples relative to input samples repeat every
+	// to samples, so their kernels are computed in advance.
+	from, to int
+	kernels  []kernel
+}
+
+// kernel is the normalized kernel of an output sample.
+type kernel struct {
+	lo      int // offset of the first input sample
+	weights []float64
+}
+
+// maxKernels is the maximum number of kernels computed in advance.
+const maxKernels = 1024
+
+// newResampler returns a resampler from one sample rate to another.
+func newResampler(from, to int) *resampler {
+	r := newStepResampler(float64(from) / float64(to))
+	g := gcd(from, to)
+	if to/g > maxKernels {
+		return r
+	}
+	r.from, r.to = from/g, to/g
+	r.kernels = make([]kernel, r.to)
+	for i := range r.kernels {
+		p := float64(i) * r.step
+		lo := int(math.Ceil(p - r.width))
+		k := kernel{lo: lo}
+		var wsum float64
+		for j := lo; j <= int(math.Floor(p+r.width)); j++ {
+			w := r.weight(p - float64(j))
+			k.weights = append(k.weights, w)
+			wsum += w
+		}
+		for j := range k.weights {
+			k.weights[j] /= wsum
+		}
+		r.kernels[i] = k
+	}
+	return r
+}
+
+// newStepResampler returns a resampler with the given distance between
+// output samples in input samples.
+func newStepResampler(step float64) *resampler {
+	r := &resampler{step: step, cutoff: math.Min(1, 1/step)}
+	r.width = sincZeros / r.cutoff
+	return r
+}
+
+// weight returns the weight of an input sample at the given distance.
+func (r *resampler) weight(d float64) float64 {
+	x := math.Abs(d) * r.cutoff * sincResolution
+	k := int(x)
+	if k >= len(sincTable)-1 {
+		return 0
+	}
+	return sincTable[k] + (sincTable[k+1]-sincTable[k])*(x-float64(k))
+}
+
+// span returns the range of input samples needed to compute output samples
+// from i0 to i1 (exclusive) of a sound of n input samples.
+func (r *resampler) span(i0, i1, n int) (j0, j1 int) {
+	j0 = maxInt(0, int(math.Ceil(float64(i0)*r.step-r.width))-1)
+	j1 = minInt(n, int(math.Floor(float64(i1-1)*r.step+r.width))+2)
+	return j0, j1
+}
+
+// resample writes output samples starting from i0 of a sound of n input
+// samples to dst. Src contains input samples starting from j0, which must
+// include the span of dst.
+func (r *resampler) resample(dst []int16, i0 int, src []int16, j0, n int) {
+	for i := range dst {
+		if r.kernels != nil {
+			q, ph := (i0+i)/r.to, (i0+i)%r.to
+			k := &r.kernels[ph]
+			lo := q*r.from + k.lo
+			if lo >= 0 && lo+len(k.weights) <= n {
+				var sum float64
+				for j, v := range src[lo-j0 : lo-j0+len(k.weights)] {
+					sum += k.weights[j] * float64(v)
+				}
+				dst[i] = clampSample(int(math.Round(sum)))
+				continue
+			}
+		}
+		// Near the edges, or if kernels are not computed.
+		p := float64(i0+i) * r.step
+		lo := maxInt(0, int(math.Ceil(p-r.width)))
+		hi := minInt(n-1, int(math.Floor(p+r.width)))
+		var sum, wsum float64
+		for j := lo; j <= hi; j++ {
+			w := r.weight(p - float64(j))
+			sum += w * float64(src[j-j0])
+			wsum += w
+		}
+		if wsum != 0 {
+			sum /= wsum
+		}
+		dst[i] = clampSample(int(math.Round(sum)))
+	}
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// resampledLen returns the number of samples after resampling n samples from
+// one sample rate to another.
+func resampledLen(n, from, to int) int {
+	return int(int64(n) * int64(to) / int64(from))
+}
+
+// resample returns samples converted from one sample rate to another.
+func resample(a []int16, from, to int) []int16 {
+	b := make([]int16, resampledLen(len(a), from, to))
+	newResampler(from, to).resample(b, 0, a, 0, len(a))
+	return b
+}
+
+// changeSpeed returns new samples with the speed and pitch changed, so that
+// the sound becomes longer by the given factor.
+func changeSpeed(a []int16, factor float64) []int16 {
+	b := make([]int16, int(math.Floor(float64(len(a))*factor)))
+	newStepResampler(1/factor).resample(b, 0, a, 0, len(a))
+	return b
+}
+
+// wsola describes frames of WSOLA time stretching at a sample rate.
+type wsola struct {
+	frameLen  int // 20 ms
+	hop       int // 50% overlap
+	tolerance int // 2.5 ms
+	window    []float64
+}
+
+// newWSOLA returns frames of WSOLA time stretching at the given sample rate.
+func newWSOLA(rate int) *wsola {
+	w := &wsola{frameLen: rate / 50, tolerance: rate / 400}
+	w.hop = w.frameLen / 2
+	// Periodic Hann window, which adds up to one with 50% overlap.
+	w.window = make([]float64, w.frameLen)
+	for i := range w.window {
+		w.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(w.frameLen))
+	}
+	return w
+}
+
+// timeStretch returns the sound at the given sample rate made longer by the
+// given factor without changing its pitch. It uses waveform similarity
+// overlap-add (WSOLA): frames are taken from the sound at positions scaled
+// by the factor, each shifted within a small tolerance to best continue the
+// waveform of the previous frame, and added with a window.
+func timeStretch(a []int16, factor float64, rate int) []int16 {
+	n := int(math.Floor(float64(len(a)) * factor))
+	w := newWSOLA(rate)
+	if len(a) < 2*w.frameLen {
+		// Short sounds are resampled.
+		return changeSpeed(a, factor)
+	}
+	out := make([]float64, n+w.frameLen)
+	// Samples padded with silence, so that frames may start before the
+	// beginning and end after the end of the sound.
+	pad := w.frameLen + w.tolerance
+	in := make([]float64, len(a)+2*pad)
+	for i, v := range a {
+		in[pad+i] = float64(v)
+	}
+	prev := 0
+	for k := 0; k*w.hop < n; k++ {
+		pos := int(float64(k*w.hop) / factor)
+		if k > 0 {
+			// Find the frame that is the most similar to the
+			// natural continuation of the previous one in the
+			// overlapping part.
+			next := in[pad+prev+w.hop:][:w.hop]
+			best, bestCorr := pos, math.Inf(-1)
+			for d := -w.tolerance; d <= w.tolerance; d++ {
+				var corr float64
+				for j, v := range in[pad+pos+d:][:w.hop] {
+					corr += next[j] * v
+				}
+				if corr > bestCorr {
+					best, bestCorr = pos+d, corr
+				}
+			}
+			pos = best
+		}
+		frame := out[k*w.hop:]
+		for j, v := range in[pad+pos:][:w.frameLen] {
+			frame[j] += v * w.window[j]
+		}
+		prev = pos
+	}
+	b := make([]int16, n)
+	for i := range b {
+		b[i] = clampSample(int(math.Round(out[i])))
+	}
+	return b
+}
+
+// changeVoice returns the sound at the given sample rate made longer by the
+// tempo factor, with pitch multiplied by the pitch factor.
+func changeVoice(a []int16, tempo, pitch float64, rate int) []int16 {
+	// Resampling raises pitch and shortens the sound, which is then
+	// stretched back to the required duration.
+	return timeStretch(changeSpeed(a, 1/pitch), tempo*pitch, rate)
+}
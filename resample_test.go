@@ -0,0 +1,99 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"math"
+	"testing"
+)
+
+func sine(freq float64, n, rate int) []int16 {
+	s := make([]int16, n)
+	for i := range s {
+		s[i] = int16(10000 * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+	}
+	return s
+}
+
+func rms(s []int16) float64 {
+	var sum float64
+	for _, v := range s {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum / float64(len(s)))
+}
+
+// frequency returns the frequency of a tone estimated from the number of
+// zero crossings.
+func frequency(s []int16, rate int) float64 {
+	n := 0
+	for i := 1; i < len(s); i++ {
+		if (s[i-1] < 0) != (s[i] < 0) {
+			n++
+		}
+	}
+	return float64(n) / 2 / (float64(len(s)) / float64(rate))
+}
+
+func TestResample(t *testing.T) {
+	// Upsampling reproduces the tone.
+	r := resample(sine(440, 8000, 8000), 8000, 22050)
+	if len(r) != 22050 {
+		t.Fatalf("expected 22050 samples, got %d", len(r))
+	}
+	want := sine(440, 22050, 22050)
+	for i := 100; i < len(r)-100; i++ {
+		if d := int(r[i]) - int(want[i]); d < -50 || d > 50 {
+			t.Fatalf("sample %d: expected %d, got %d", i, want[i], r[i])
+		}
+	}
+	// Downsampling keeps tones below the new Nyquist frequency and
+	// removes those above it instead of aliasing them.
+	if v := rms(resample(sine(1000, 22050, 22050), 22050, 8000)); v < 6500 {
+		t.Errorf("1000 Hz tone is attenuated to RMS %.0f", v)
+	}
+	if v := rms(resample(sine(6000, 22050, 22050), 22050, 8000)[100:7900]); v > 200 {
+		t.Errorf("6000 Hz tone is aliased with RMS %.0f", v)
+	}
+	// Rates with large denominators are resampled without kernels
+	// computed in advance.
+	if r := resample(sine(440, 22050, 22050), 22050, 22051); math.Abs(frequency(r, 22051)-440) > 2 {
+		t.Errorf("wrong frequency %.1f", frequency(r, 22051))
+	}
+}
+
+func TestChangeVoice(t *testing.T) {
+	tests := []struct {
+		tempo, pitch float64
+	}{
+		{1, 1},
+		{1.5, 1},
+		{0.8, 1},
+		{1, 1.2},
+		{1.2, 0.85},
+	}
+	for _, rate := range []int{8000, sampleRate} {
+		s := sine(200, rate, rate)
+		frameLen := newWSOLA(rate).frameLen
+		for _, test := range tests {
+			r := changeVoice(s, test.tempo, test.pitch, rate)
+			if n := int(float64(len(s)) * test.tempo); len(r) < n-2 || len(r) > n+2 {
+				t.Errorf("%d Hz %+v: expected %d samples, got %d", rate, test, n, len(r))
+			}
+			if f := frequency(r[frameLen:len(r)-frameLen], rate); math.Abs(f-200*test.pitch) > 5 {
+				t.Errorf("%d Hz %+v: expected frequency %.0f, got %.1f", rate, test, 200*test.pitch, f)
+			}
+			if v := rms(r[frameLen : len(r)-frameLen]); v < 6500 || v > 7700 {
+				t.Errorf("%d Hz %+v: wrong level %.0f", rate, test, v)
+			}
+		}
+	}
+	// Speed changes both.
+	s := sine(200, sampleRate, sampleRate)
+	r := changeSpeed(s, 1.25)
+	if f := frequency(r, sampleRate); len(r) != len(s)*5/4 || math.Abs(f-160) > 2 {
+		t.Errorf("changeSpeed: got %d samples with frequency %.1f", len(r), f)
+	}
+}
@@ -6,13 +6,17 @@ package captcha
 
 import (
 	"bytes"
+	"errors"
 	"net/http"
 	"path"
 	"strings"
 	"time"
 )
 
+var errNotAcceptable = errors.New("captcha: no acceptable image format")
+
 type captchaHandler struct {
+	m         *Manager
 	imgWidth  int
 	imgHeight int
 }
@@ -21,11 +25,13 @@ type captchaHandler struct {
 // audio representations of captchas. Image dimensions are accepted as
 // arguments. The server decides which captcha to serve based on the last URL
 // path component: file name part must contain a captcha id, file extension —
-// its format (PNG or WAV).
+// its format (PNG, JPEG, WebP, animated GIF, SVG, WAV, or any image format
+// added with RegisterEncoder).
 //
 // For example, for file name "LBm5vMjHDtdUfaWYXiQX.png" it serves an image captcha
 // with id "LBm5vMjHDtdUfaWYXiQX", and for "LBm5vMjHDtdUfaWYXiQX.wav" it serves the
-// same captcha in audio format.
+// same captcha in audio format. If the file name has no extension, it serves
+// an image in the format preferred by the Accept request header, or PNG.
 //
 // To serve a captcha as a downloadable file, the URL must be constructed in
 // such a way as if the file to serve is in the "download" subdirectory:
@@ -40,7 +46,7 @@ type captchaHandler struct {
 // captcha in one of the other supported languages, append "lang" value, for
 // example, "?lang=ru".
 func Server(imgWidth, imgHeight int) http.Handler {
-	return &captchaHandler{imgWidth, imgHeight}
+	return &captchaHandler{defaultManager, imgWidth, imgHeight}
 }
 
 func (h *captchaHandler) serve(w http.ResponseWriter, r *http.Request, id, ext, lang string, download bool) error {
@@ -49,20 +55,47 @@ func (h *captchaHandler) serve(w http.ResponseWriter, r *http.Request, id, ext,
 	w.Header().Set("Expires", "0")
 
 	var content bytes.Buffer
+	var err error
+	// Audio is read directly from its renderer, other formats are
+	// written into content.
+	var audio *Audio
+	if ext == "" {
+		// Choose image format from the Accept header.
+		w.Header().Set("Vary", "Accept")
+		var ok bool
+		if ext, ok = encoderForAccept(r.Header.Get("Accept")); !ok {
+			return errNotAcceptable
+		}
+	}
 	switch ext {
-	case ".png":
-		w.Header().Set("Content-Type", "image/png")
-		WriteImage(&content, id, h.imgWidth, h.imgHeight)
+	case ".gif":
+		w.Header().Set("Content-Type", "image/gif")
+		err = h.m.WriteAnimatedImageContext(r.Context(), &content, id, h.imgWidth, h.imgHeight)
+	case ".svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = h.m.WriteSVGImageContext(r.Context(), &content, id, h.imgWidth, h.imgHeight)
 	case ".wav":
 		w.Header().Set("Content-Type", "audio/x-wav")
-		WriteAudio(&content, id, lang)
+		audio, err = h.m.audio(r.Context(), id, lang)
 	default:
-		return ErrNotFound
+		e, ok := encoderForExt(ext)
+		if !ok {
+			return ErrNotFound
+		}
+		w.Header().Set("Content-Type", e.ContentType())
+		err = h.m.WriteEncodedImageContext(r.Context(), &content, id, h.imgWidth, h.imgHeight, e)
+	}
+	if err != nil {
+		return err
 	}
 
 	if download {
 		w.Header().Set("Content-Type", "application/octet-stream")
 	}
+	if audio != nil {
+		http.ServeContent(w, r, id+ext, time.Time{}, audio.NewReader())
+		return nil
+	}
 	http.ServeContent(w, r, id+ext, time.Time{}, bytes.NewReader(content.Bytes()))
 	return nil
 }
@@ -71,17 +104,22 @@ func (h *captchaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	dir, file := path.Split(r.URL.Path)
 	ext := path.Ext(file)
 	id := file[:len(file)-len(ext)]
-	if ext == "" || id == "" {
+	if id == "" {
 		http.NotFound(w, r)
 		return
 	}
 	if r.FormValue("reload") != "" {
-		Reload(id)
+		h.m.ReloadContext(r.Context(), id)
 	}
 	lang := strings.ToLower(r.FormValue("lang"))
 	download := path.Base(dir) == "download"
-	if h.serve(w, r, id, ext, lang, download) == ErrNotFound {
+	switch err := h.serve(w, r, id, ext, lang, download); err {
+	case nil:
+	case ErrNotFound, ErrExpired, ErrNoAudio:
 		http.NotFound(w, r)
+	case errNotAcceptable:
+		http.Error(w, errNotAcceptable.Error(), http.StatusNotAcceptable)
+	default:
+		http.Error(w, "captcha: store error", http.StatusInternalServerError)
 	}
-	// Ignore other errors.
 }
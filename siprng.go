@@ -219,6 +219,22 @@ func (p *siprng) Bytes(n int) []byte {
 	return b[:n]
 }
 
+// ReadAt fills b with bytes that Bytes would return starting at offset off
+// right after seeding. It doesn't change the state of PRNG.
+func (p *siprng) ReadAt(b []byte, off int64) (n int, err error) {
+	ctr := uint64(off/8) + 1
+	v := siphash(p.k0, p.k1, ctr) >> (8 * uint(off%8))
+	for i := range b {
+		if i > 0 && (off+int64(i))%8 == 0 {
+			ctr++
+			v = siphash(p.k0, p.k1, ctr)
+		}
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return len(b), nil
+}
+
 func (p *siprng) Int63() int64 {
 	return int64(p.Uint64() & 0x7fffffffffffffff)
 }
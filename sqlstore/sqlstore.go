@@ -0,0 +1,311 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package sqlstore implements a captcha store on top of database/sql.
+//
+// Captchas are kept in a table with four columns: id, digits (encoded in
+// hex), expiration time (in milliseconds since Unix epoch) and the number of
+// failed verification attempts. The table can be created with CreateTable:
+//
+//	db, err := sql.Open("sqlite3", "captcha.db")
+//	...
+//	s := sqlstore.New(db, "captcha", sqlstore.SQLite)
+//	if err := s.CreateTable(ctx); err != nil {
+//		...
+//	}
+//	defer s.StartSweeper(time.Minute)()
+//	captcha.SetCustomStoreContext(s)
+//
+// Expired captchas are never returned (captcha.ErrExpired is reported
+// instead), but they stay in the table until they are deleted by Sweep,
+// which is called periodically by the sweeper started with StartSweeper.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dchest/captcha"
+)
+
+// Dialect selects SQL syntax differences between databases.
+type Dialect int
+
+const (
+	// SQLite uses "?" placeholders.
+	SQLite Dialect = iota
+	// MySQL uses "?" placeholders and declares the expiration index inside
+	// CREATE TABLE.
+	MySQL
+	// Postgres uses "$1", "$2", ... placeholders.
+	Postgres
+)
+
+// Store is a captcha store that keeps captchas in an SQL database table. It
+// implements captcha.AttemptStore and captcha.TTLStore interfaces; use
+// captcha.NewLegacyStore to get captcha.Store.
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+
+	getQuery      string
+	attemptsQuery string
+	addQuery      string
+	deleteQuery   string
+	insertQuery   string
+	sweepQuery    string
+	createQueries []string
+}
+
+// New returns a new store that keeps captchas in the given table of the
+// database. The table name is inserted into queries as is, so it must not come
+// from untrusted input.
+func New(db *sql.DB, table string, dialect Dialect) *Store {
+	s := &Store{db: db, dialect: dialect}
+	s.getQuery = s.rebind("SELECT digits, expires FROM " + table + " WHERE id = ?")
+	s.attemptsQuery = s.rebind("SELECT attempts FROM " + table + " WHERE id = ?")
+	s.addQuery = s.rebind("UPDATE " + table + " SET attempts = attempts + 1 WHERE id = ? AND expires > ?")
+	s.deleteQuery = s.rebind("DELETE FROM " + table + " WHERE id = ?")
+	s.insertQuery = s.rebind("INSERT INTO " + table + " (id, digits, expires) VALUES (?, ?, ?)")
+	s.sweepQuery = s.rebind("DELETE FROM " + table + " WHERE expires <= ?")
+	switch dialect {
+	case MySQL:
+		s.createQueries = []string{
+			"CREATE TABLE IF NOT EXISTS " + table + " (" +
+				"id VARCHAR(64) NOT NULL PRIMARY KEY, " +
+				"digits VARCHAR(255) NOT NULL, " +
+				"expires BIGINT NOT NULL, " +
+				"attempts INT NOT NULL DEFAULT 0, " +
+				"INDEX " + table + "_expires (expires))",
+		}
+	default:
+		s.createQueries = []string{
+			"CREATE TABLE IF NOT EXISTS " + table + " (" +
+				"id VARCHAR(64) NOT NULL PRIMARY KEY, " +
+				"digits VARCHAR(255) NOT NULL, " +
+				"expires BIGINT NOT NULL, " +
+				"attempts INT NOT NULL DEFAULT 0)",
+			"CREATE INDEX IF NOT EXISTS " + table + "_expires ON " + table + " (expires)",
+		}
+	}
+	return s
+}
+
+// rebind replaces "?" placeholders in the query with the ones used by the
+// store's dialect.
+func (s *Store) rebind(query string) string {
+	if s.dialect != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Schema returns SQL statements that create the store's table and index.
+func (s *Store) Schema() []string {
+	return append([]string(nil), s.createQueries...)
+}
+
+// CreateTable creates the store's table and index if they don't exist.
+func (s *Store) CreateTable(ctx context.Context) error {
+	for _, q := range s.createQueries {
+		if _, err := s.db.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timestamp converts t into the representation of the expires column.
+func timestamp(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// Set saves the digits for the captcha id, replacing the existing ones. If
+// ttl is zero, captcha.Expiration is used.
+func (s *Store) Set(ctx context.Context, id string, digits []byte, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = captcha.Expiration
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, s.deleteQuery, id); err != nil {
+		return err
+	}
+	expires := timestamp(time.Now().Add(ttl))
+	if _, err := tx.ExecContext(ctx, s.insertQuery, id, hex.EncodeToString(digits), expires); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// get returns digits from the row with the given id.
+func (s *Store) get(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}, id string) ([]byte, error) {
+	hexDigits, _, err := s.getRow(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(hexDigits)
+}
+
+// getRow returns hex-encoded digits and the expiration timestamp from the
+// row with the given id.
+func (s *Store) getRow(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}, id string) (hexDigits string, expires int64, err error) {
+	err = q.QueryRowContext(ctx, s.getQuery, id).Scan(&hexDigits, &expires)
+	if err == sql.ErrNoRows {
+		return "", 0, captcha.ErrNotFound
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if expires <= timestamp(time.Now()) {
+		return "", 0, captcha.ErrExpired
+	}
+	return hexDigits, expires, nil
+}
+
+// Get returns stored digits for the captcha id.
+func (s *Store) Get(ctx context.Context, id string) ([]byte, error) {
+	return s.get(ctx, s.db, id)
+}
+
+// GetAndDelete returns stored digits for the captcha id and deletes it. If it
+// is called concurrently for the same id, only the call that deletes the row
+// returns the digits.
+func (s *Store) GetAndDelete(ctx context.Context, id string) ([]byte, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	digits, err := s.get(ctx, tx, id)
+	if err != nil && err != captcha.ErrNotFound && err != captcha.ErrExpired {
+		return nil, err
+	}
+	res, err2 := tx.ExecContext(ctx, s.deleteQuery, id)
+	if err2 != nil {
+		return nil, err2
+	}
+	if err != nil {
+		// Expired or missing; delete expired captcha anyway.
+		tx.Commit()
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n != 1 {
+		// Deleted by someone else.
+		return nil, captcha.ErrNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return digits, nil
+}
+
+// AddAttempt increments the number of failed verification attempts of the
+// captcha id and returns it. The number is reset by Set.
+func (s *Store) AddAttempt(ctx context.Context, id string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, s.addQuery, id, timestamp(time.Now()))
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n != 1 {
+		// Missing or expired: find out which.
+		if _, err := s.get(ctx, tx, id); err != nil {
+			return 0, err
+		}
+		return 0, captcha.ErrNotFound
+	}
+	var attempts int
+	if err := tx.QueryRowContext(ctx, s.attemptsQuery, id).Scan(&attempts); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return attempts, nil
+}
+
+// TTL returns the time left until the captcha id expires.
+func (s *Store) TTL(ctx context.Context, id string) (time.Duration, error) {
+	_, expires, err := s.getRow(ctx, s.db, id)
+	if err != nil {
+		return 0, err
+	}
+	ttl := time.Duration(expires-timestamp(time.Now())) * time.Millisecond
+	if ttl <= 0 {
+		return 0, captcha.ErrExpired
+	}
+	return ttl, nil
+}
+
+// Delete deletes the captcha with the given id.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.deleteQuery, id)
+	return err
+}
+
+// Sweep deletes expired captchas from the table and returns their number.
+func (s *Store) Sweep(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, s.sweepQuery, timestamp(time.Now()))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// StartSweeper starts a goroutine that calls Sweep with the given interval
+// and returns a function that stops it. Errors returned by Sweep are
+// ignored: expired captchas that failed to be deleted will be deleted on the
+// next run.
+func (s *Store) StartSweeper(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				s.Sweep(context.Background())
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -0,0 +1,457 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package sqlstore
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dchest/captcha"
+)
+
+// fakeDriver is an in-memory database/sql driver that understands only the
+// statements issued by Store. Each data source name is a separate database.
+type fakeDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*fakeDB
+}
+
+type fakeRow struct {
+	digits   string
+	expires  int64
+	attempts int64
+}
+
+// fakeDB is a single database. Its mutex is held for the duration of a
+// statement or a transaction, so transactions are serializable.
+type fakeDB struct {
+	mu     sync.Mutex
+	tables map[string]map[string]fakeRow
+}
+
+var driverInstance = &fakeDriver{dbs: make(map[string]*fakeDB)}
+
+func init() {
+	sql.Register("captchafake", driverInstance)
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db, ok := d.dbs[name]
+	if !ok {
+		db = &fakeDB{tables: make(map[string]map[string]fakeRow)}
+		d.dbs[name] = db
+	}
+	return &fakeConn{db: db}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+	// snapshot of tables taken at the beginning of transaction.
+	snapshot map[string]map[string]fakeRow
+	inTx     bool
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c, query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	c.inTx = true
+	c.snapshot = make(map[string]map[string]fakeRow)
+	for name, t := range c.db.tables {
+		ct := make(map[string]fakeRow)
+		for k, v := range t {
+			ct[k] = v
+		}
+		c.snapshot[name] = ct
+	}
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.inTx = false
+	c.snapshot = nil
+	c.db.mu.Unlock()
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.db.tables = c.snapshot
+	return c.Commit()
+}
+
+var (
+	placeholderRe = regexp.MustCompile(`\$\d+`)
+	createTableRe = regexp.MustCompile(`^CREATE TABLE IF NOT EXISTS (\w+) `)
+	createIndexRe = regexp.MustCompile(`^CREATE INDEX IF NOT EXISTS \w+ ON (\w+) `)
+	insertRe      = regexp.MustCompile(`^INSERT INTO (\w+) \(id, digits, expires\) VALUES \(\?, \?, \?\)$`)
+	deleteIdRe    = regexp.MustCompile(`^DELETE FROM (\w+) WHERE id = \?$`)
+	sweepRe       = regexp.MustCompile(`^DELETE FROM (\w+) WHERE expires <= \?$`)
+	selectRe      = regexp.MustCompile(`^SELECT digits, expires FROM (\w+) WHERE id = \?$`)
+	attemptsRe    = regexp.MustCompile(`^SELECT attempts FROM (\w+) WHERE id = \?$`)
+	addAttemptRe  = regexp.MustCompile(`^UPDATE (\w+) SET attempts = attempts \+ 1 WHERE id = \? AND expires > \?$`)
+)
+
+func (c *fakeConn) table(name string) (map[string]fakeRow, error) {
+	t, ok := c.db.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("no such table: %s", name)
+	}
+	return t, nil
+}
+
+func (c *fakeConn) exec(query string, args []driver.Value) (driver.Result, error) {
+	if !c.inTx {
+		c.db.mu.Lock()
+		defer c.db.mu.Unlock()
+	}
+	query = placeholderRe.ReplaceAllString(query, "?")
+	if m := createTableRe.FindStringSubmatch(query); m != nil {
+		if _, ok := c.db.tables[m[1]]; !ok {
+			c.db.tables[m[1]] = make(map[string]fakeRow)
+		}
+		return driver.RowsAffected(0), nil
+	}
+	if m := createIndexRe.FindStringSubmatch(query); m != nil {
+		_, err := c.table(m[1])
+		return driver.RowsAffected(0), err
+	}
+	if m := insertRe.FindStringSubmatch(query); m != nil {
+		t, err := c.table(m[1])
+		if err != nil {
+			return nil, err
+		}
+		id := args[0].(string)
+		if _, ok := t[id]; ok {
+			return nil, errors.New("UNIQUE constraint failed")
+		}
+		t[id] = fakeRow{args[1].(string), args[2].(int64), 0}
+		return driver.RowsAffected(1), nil
+	}
+	if m := deleteIdRe.FindStringSubmatch(query); m != nil {
+		t, err := c.table(m[1])
+		if err != nil {
+			return nil, err
+		}
+		id := args[0].(string)
+		if _, ok := t[id]; !ok {
+			return driver.RowsAffected(0), nil
+		}
+		delete(t, id)
+		return driver.RowsAffected(1), nil
+	}
+	if m := addAttemptRe.FindStringSubmatch(query); m != nil {
+		t, err := c.table(m[1])
+		if err != nil {
+			return nil, err
+		}
+		id := args[0].(string)
+		r, ok := t[id]
+		if !ok || r.expires <= args[1].(int64) {
+			return driver.RowsAffected(0), nil
+		}
+		r.attempts++
+		t[id] = r
+		return driver.RowsAffected(1), nil
+	}
+	if m := sweepRe.FindStringSubmatch(query); m != nil {
+		t, err := c.table(m[1])
+		if err != nil {
+			return nil, err
+		}
+		n := 0
+		for id, r := range t {
+			if r.expires <= args[0].(int64) {
+				delete(t, id)
+				n++
+			}
+		}
+		return driver.RowsAffected(n), nil
+	}
+	return nil, fmt.Errorf("unsupported statement: %s", query)
+}
+
+func (c *fakeConn) query(query string, args []driver.Value) (driver.Rows, error) {
+	if !c.inTx {
+		c.db.mu.Lock()
+		defer c.db.mu.Unlock()
+	}
+	query = placeholderRe.ReplaceAllString(query, "?")
+	if m := selectRe.FindStringSubmatch(query); m != nil {
+		t, err := c.table(m[1])
+		if err != nil {
+			return nil, err
+		}
+		rows := &fakeRows{columns: []string{"digits", "expires"}}
+		if r, ok := t[args[0].(string)]; ok {
+			rows.values = [][]driver.Value{{r.digits, r.expires}}
+		}
+		return rows, nil
+	}
+	if m := attemptsRe.FindStringSubmatch(query); m != nil {
+		t, err := c.table(m[1])
+		if err != nil {
+			return nil, err
+		}
+		rows := &fakeRows{columns: []string{"attempts"}}
+		if r, ok := t[args[0].(string)]; ok {
+			rows.values = [][]driver.Value{{r.attempts}}
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("unsupported query: %s", query)
+}
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.exec(s.query, args)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.query(s.query, args)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func newTestStore(t *testing.T, dialect Dialect) *Store {
+	db, err := sql.Open("captchafake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(db, "captcha", dialect)
+	if err := s.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSetGet(t *testing.T) {
+	for _, dialect := range []Dialect{SQLite, MySQL, Postgres} {
+		ctx := context.Background()
+		s := newTestStore(t, dialect)
+		d := captcha.RandomDigits(10)
+		if err := s.Set(ctx, "id", d, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		d2, err := s.Get(ctx, "id")
+		if err != nil || !bytes.Equal(d, d2) {
+			t.Errorf("%d: saved %v, Get returned %v, %v", dialect, d, d2, err)
+		}
+		// Replace digits.
+		d = captcha.RandomDigits(10)
+		if err := s.Set(ctx, "id", d, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		d2, err = s.GetAndDelete(ctx, "id")
+		if err != nil || !bytes.Equal(d, d2) {
+			t.Errorf("%d: saved %v, GetAndDelete returned %v, %v", dialect, d, d2, err)
+		}
+		if _, err := s.Get(ctx, "id"); err != captcha.ErrNotFound {
+			t.Errorf("%d: GetAndDelete didn't delete: %v", dialect, err)
+		}
+		if _, err := s.GetAndDelete(ctx, "id"); err != captcha.ErrNotFound {
+			t.Errorf("%d: expected ErrNotFound, got %v", dialect, err)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, SQLite)
+	s.Set(ctx, "id", captcha.RandomDigits(10), time.Minute)
+	if err := s.Delete(ctx, "id"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "id"); err != captcha.ErrNotFound {
+		t.Errorf("Delete didn't delete: %v", err)
+	}
+	if err := s.Delete(ctx, "id"); err != nil {
+		t.Errorf("deleting nonexistent captcha: %v", err)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, SQLite)
+	d := captcha.RandomDigits(10)
+	s.Set(ctx, "expired1", d, -time.Second)
+	s.Set(ctx, "expired2", d, -time.Second)
+	s.Set(ctx, "fresh", d, time.Minute)
+	if _, err := s.Get(ctx, "expired1"); err != captcha.ErrExpired {
+		t.Errorf("Get: expected ErrExpired for expired captcha, got %v", err)
+	}
+	if _, err := s.GetAndDelete(ctx, "expired1"); err != captcha.ErrExpired {
+		t.Errorf("GetAndDelete: expected ErrExpired for expired captcha, got %v", err)
+	}
+	if _, err := s.Get(ctx, "expired1"); err != captcha.ErrNotFound {
+		t.Errorf("GetAndDelete didn't delete expired captcha: %v", err)
+	}
+	n, err := s.Sweep(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 swept captcha, got %d", n)
+	}
+	if _, err := s.Get(ctx, "fresh"); err != nil {
+		t.Errorf("fresh captcha swept: %v", err)
+	}
+	if ttl, err := s.TTL(ctx, "fresh"); ttl <= 0 || ttl > time.Minute || err != nil {
+		t.Errorf("TTL: expected at most a minute, got %v, %v", ttl, err)
+	}
+	if _, err := s.TTL(ctx, "expired2"); err != captcha.ErrNotFound {
+		t.Errorf("TTL: expected ErrNotFound for swept captcha, got %v", err)
+	}
+}
+
+func TestSweeper(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, SQLite)
+	s.Set(ctx, "expired", captcha.RandomDigits(10), -time.Second)
+	stop := s.StartSweeper(time.Millisecond)
+	defer stop()
+	for i := 0; i < 1000; i++ {
+		if n, _ := s.Sweep(ctx); n == 0 {
+			// Already swept either by us or by sweeper.
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("captcha not swept")
+}
+
+func TestConcurrentGetAndDelete(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, SQLite)
+	s.Set(ctx, "id", captcha.RandomDigits(10), time.Minute)
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		ok int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.GetAndDelete(ctx, "id"); err == nil {
+				mu.Lock()
+				ok++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if ok != 1 {
+		t.Errorf("expected exactly one successful GetAndDelete, got %d", ok)
+	}
+}
+
+func TestMissingTable(t *testing.T) {
+	db, err := sql.Open("captchafake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(db, "captcha", SQLite)
+	if _, err := s.Get(context.Background(), "id"); err == nil || err == captcha.ErrNotFound {
+		t.Errorf("expected database error, got %v", err)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	s := New(nil, "captcha", Postgres)
+	if !strings.HasSuffix(s.insertQuery, "VALUES ($1, $2, $3)") {
+		t.Errorf("wrong placeholders: %s", s.insertQuery)
+	}
+	if len(New(nil, "captcha", MySQL).Schema()) != 1 {
+		t.Errorf("MySQL schema must declare index inside CREATE TABLE")
+	}
+}
+
+func TestManager(t *testing.T) {
+	s := newTestStore(t, Postgres)
+	m := captcha.NewManager(captcha.Config{Store: s})
+	id := m.New()
+	d, err := s.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Verify(id, d) {
+		t.Errorf("proper captcha not verified")
+	}
+	// Legacy interface.
+	l := captcha.NewLegacyStore(s, time.Minute)
+	l.Set("legacy", d)
+	if !bytes.Equal(l.Get("legacy", true), d) || l.Get("legacy", false) != nil {
+		t.Errorf("legacy store doesn't work")
+	}
+}
+
+func TestAddAttempt(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, Postgres)
+	d := captcha.RandomDigits(10)
+	s.Set(ctx, "id", d, time.Minute)
+	for i := 1; i <= 2; i++ {
+		if n, err := s.AddAttempt(ctx, "id"); n != i || err != nil {
+			t.Errorf("expected %d attempts, got %d, %v", i, n, err)
+		}
+	}
+	s.Set(ctx, "id", d, time.Minute)
+	if n, _ := s.AddAttempt(ctx, "id"); n != 1 {
+		t.Errorf("Set didn't reset attempts: got %d", n)
+	}
+	if _, err := s.AddAttempt(ctx, "nonexistent"); err != captcha.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	s.Set(ctx, "expired", d, -time.Second)
+	if _, err := s.AddAttempt(ctx, "expired"); err != captcha.ErrExpired {
+		t.Errorf("expected ErrExpired, got %v", err)
+	}
+	m := captcha.NewManager(captcha.Config{Store: s, MaxAttempts: 2})
+	id := m.New()
+	if r, _ := m.Check(ctx, id, []byte{1}); r != captcha.ResultWrong {
+		t.Errorf("expected %v, got %v", captcha.ResultWrong, r)
+	}
+	if r, _ := m.Check(ctx, id, []byte{1}); r != captcha.ResultExhausted {
+		t.Errorf("expected %v, got %v", captcha.ResultExhausted, r)
+	}
+}
@@ -5,8 +5,10 @@
 package captcha
 
 import (
-	"container/list"
+	"container/heap"
+	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,92 +28,462 @@ type Store interface {
 	Get(id string, clear bool) (digits []byte)
 }
 
-// expValue stores timestamp and id of captchas. It is used in the list inside
-// memoryStore for indexing generated captchas by timestamp to enable garbage
-// collection of expired captchas.
-type idByTimeValue struct {
-	timestamp time.Time
-	id        string
+// An object implementing StoreContext interface can be registered with
+// SetCustomStoreContext function or passed in Config to NewManager. Unlike
+// Store, it accepts a context, receives the expiration time of each captcha
+// and reports errors, so that failures of the underlying storage (such as a
+// database) are not confused with missing captchas.
+//
+// Methods must return ErrNotFound if there is no captcha with the given id.
+// Stores that keep expired captchas until they are collected may return
+// ErrExpired for them instead.
+type StoreContext interface {
+	// Set sets the digits for the captcha id. The captcha must expire
+	// after the given ttl. If ttl is zero, the store's default
+	// expiration time is used (Expiration, if the store doesn't have its
+	// own setting).
+	Set(ctx context.Context, id string, digits []byte, ttl time.Duration) error
+
+	// Get returns stored digits for the captcha id. Expired captchas
+	// must not be returned, even if they are still in the store.
+	Get(ctx context.Context, id string) (digits []byte, err error)
+
+	// GetAndDelete returns stored digits for the captcha id and deletes
+	// the captcha from the store. It must be atomic: if called
+	// concurrently for the same id, only one call may return the digits.
+	GetAndDelete(ctx context.Context, id string) (digits []byte, err error)
+
+	// Delete deletes the captcha with the given id. Deleting a captcha
+	// that doesn't exist is not an error.
+	Delete(ctx context.Context, id string) error
+}
+
+// AttemptStore is a StoreContext that counts failed attempts to verify
+// captchas. Managers configured to allow more than one verification attempt
+// require stores implementing this interface; with other stores, a captcha
+// is deleted after the first attempt.
+type AttemptStore interface {
+	StoreContext
+
+	// AddAttempt increments the number of failed verification attempts
+	// of the captcha with the given id and returns the new number. The
+	// number must be reset to zero when the captcha's digits are set.
+	AddAttempt(ctx context.Context, id string) (attempts int, err error)
+}
+
+// TTLStore is a StoreContext that reports how long captchas have left until
+// they expire. Reloaded captchas keep their expiration time in stores
+// implementing this interface; in other stores, they get the manager's
+// expiration time.
+type TTLStore interface {
+	StoreContext
+
+	// TTL returns the time left until the captcha with the given id
+	// expires.
+	TTL(ctx context.Context, id string) (time.Duration, error)
+}
+
+// WrapStore returns a StoreContext that uses the given Store. As Store
+// doesn't report errors, the returned store reports ErrNotFound for captchas
+// it can't get. Expiration time passed to Set is ignored: the wrapped store
+// expires captchas by itself.
+//
+// If the given store is a memory store, the returned store implements
+// AttemptStore and TTLStore, honors expiration time passed to Set and reports
+// ErrExpired for expired captchas.
+func WrapStore(s Store) StoreContext {
+	if ms, ok := s.(*memoryStore); ok {
+		return &memoryStoreWrapper{ms}
+	}
+	return &storeWrapper{s}
+}
+
+type storeWrapper struct {
+	s Store
+}
+
+func (w *storeWrapper) Set(ctx context.Context, id string, digits []byte, ttl time.Duration) error {
+	w.s.Set(id, digits)
+	return nil
+}
+
+func (w *storeWrapper) Get(ctx context.Context, id string) ([]byte, error) {
+	return w.get(id, false)
+}
+
+func (w *storeWrapper) GetAndDelete(ctx context.Context, id string) ([]byte, error) {
+	return w.get(id, true)
+}
+
+func (w *storeWrapper) Delete(ctx context.Context, id string) error {
+	w.s.Get(id, true)
+	return nil
+}
+
+func (w *storeWrapper) get(id string, clear bool) ([]byte, error) {
+	digits := w.s.Get(id, clear)
+	if digits == nil {
+		return nil, ErrNotFound
+	}
+	return digits, nil
+}
+
+type memoryStoreWrapper struct {
+	s *memoryStore
+}
+
+func (w *memoryStoreWrapper) Set(ctx context.Context, id string, digits []byte, ttl time.Duration) error {
+	w.s.setTTL(id, digits, ttl)
+	return nil
+}
+
+func (w *memoryStoreWrapper) Get(ctx context.Context, id string) ([]byte, error) {
+	return w.s.get(id, false)
+}
+
+func (w *memoryStoreWrapper) GetAndDelete(ctx context.Context, id string) ([]byte, error) {
+	return w.s.get(id, true)
+}
+
+func (w *memoryStoreWrapper) Delete(ctx context.Context, id string) error {
+	w.s.get(id, true)
+	return nil
+}
+
+func (w *memoryStoreWrapper) AddAttempt(ctx context.Context, id string) (int, error) {
+	return w.s.addAttempt(id)
+}
+
+func (w *memoryStoreWrapper) TTL(ctx context.Context, id string) (time.Duration, error) {
+	return w.s.ttl(id)
+}
+
+// NewLegacyStore returns a Store that uses the given StoreContext, for
+// example, to register it with SetCustomStore or to pass it to code that
+// expects Store interface. Captchas are saved with the given expiration time.
+// Errors are not reported: a captcha that can't be retrieved is treated as
+// missing.
+func NewLegacyStore(s StoreContext, expiration time.Duration) Store {
+	return &legacyStore{s, expiration}
+}
+
+type legacyStore struct {
+	s          StoreContext
+	expiration time.Duration
+}
+
+func (l *legacyStore) Set(id string, digits []byte) {
+	l.s.Set(context.Background(), id, digits, l.expiration)
+}
+
+func (l *legacyStore) Get(id string, clear bool) (digits []byte) {
+	if clear {
+		digits, _ = l.s.GetAndDelete(context.Background(), id)
+	} else {
+		digits, _ = l.s.Get(context.Background(), id)
+	}
+	return
+}
+
+// memoryItem stores id, digits, expiration time and the number of failed
+// verification attempts of a captcha.
+type memoryItem struct {
+	id       string
+	digits   []byte
+	deadline time.Time
+	attempts int
+	// index of item in memoryShard.byDeadline.
+	index int
+}
+
+// deadlineHeap is a min-heap of captchas ordered by expiration time. It is
+// used inside memoryStore to enable garbage collection of expired captchas
+// and eviction of captchas closest to expiration.
+type deadlineHeap []*memoryItem
+
+func (h deadlineHeap) Len() int           { return len(h) }
+func (h deadlineHeap) Less(i, j int) bool { return h[i].deadline.Before(h[j].deadline) }
+
+func (h deadlineHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *deadlineHeap) Push(x interface{}) {
+	it := x.(*memoryItem)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *deadlineHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return it
+}
+
+// memoryShard is a part of memoryStore with its own lock.
+type memoryShard struct {
+	sync.RWMutex
+	byId       map[string]*memoryItem
+	byDeadline deadlineHeap
 }
 
 // memoryStore is an internal store for captcha ids and their values.
 type memoryStore struct {
-	sync.RWMutex
-	digitsById map[string][]byte
-	idByTime   *list.List
-	// Number of items stored since last collection.
-	numStored int
+	// Number of items stored since last collection and number of items in
+	// all shards (accessed atomically). They must be the first fields to
+	// be 64-bit aligned on 32-bit platforms.
+	numStored  int64
+	numEntries int64
+	shards     []memoryShard
 	// Number of saved items that triggers collection.
 	collectNum int
-	// Expiration time of captchas.
+	// Maximum number of items, or zero if unlimited.
+	maxEntries int
+	// Default expiration time of captchas.
 	expiration time.Duration
 }
 
+// MemoryStoreOptions describe parameters of a memory store.
+type MemoryStoreOptions struct {
+	// CollectNum is the number of captchas stored that triggers
+	// collection of expired ones. Defaults to CollectNum.
+	CollectNum int
+	// Expiration is the default expiration time of captchas. Defaults to
+	// Expiration.
+	Expiration time.Duration
+	// MaxEntries, if not zero, is the maximum number of captchas kept in
+	// the store. When the store is full, captchas closest to expiration
+	// (that is, the oldest ones, unless captchas have different
+	// expiration times) are evicted to make room for the new ones.
+	MaxEntries int
+	// Shards is the number of independently locked parts into which the
+	// store is split to reduce lock contention. Defaults to 16.
+	Shards int
+}
+
 // NewMemoryStore returns a new standard memory store for captchas with the
 // given collection threshold and expiration time (duration). The returned
 // store must be registered with SetCustomStore to replace the default one.
+//
+// Captchas saved through StoreContext interface (see WrapStore) with a
+// non-zero expiration time expire after it instead of the store's one.
 func NewMemoryStore(collectNum int, expiration time.Duration) Store {
+	return NewMemoryStoreWithOptions(MemoryStoreOptions{
+		CollectNum: collectNum,
+		Expiration: expiration,
+	})
+}
+
+// NewMemoryStoreWithOptions returns a new memory store with the given
+// options. It can be used instead of NewMemoryStore to limit the memory used
+// by the store.
+func NewMemoryStoreWithOptions(opts MemoryStoreOptions) Store {
+	if opts.CollectNum == 0 {
+		opts.CollectNum = CollectNum
+	}
+	if opts.Expiration == 0 {
+		opts.Expiration = Expiration
+	}
+	if opts.Shards <= 0 {
+		opts.Shards = 16
+	}
 	s := new(memoryStore)
-	s.digitsById = make(map[string][]byte)
-	s.idByTime = list.New()
-	s.collectNum = collectNum
-	s.expiration = expiration
+	s.shards = make([]memoryShard, opts.Shards)
+	for i := range s.shards {
+		s.shards[i].byId = make(map[string]*memoryItem)
+	}
+	s.collectNum = opts.CollectNum
+	s.expiration = opts.Expiration
+	if opts.MaxEntries > 0 {
+		s.maxEntries = opts.MaxEntries
+	}
 	return s
 }
 
+// shard returns the shard for the captcha id.
+func (s *memoryStore) shard(id string) *memoryShard {
+	// FNV-1a hash.
+	h := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		h ^= uint32(id[i])
+		h *= 16777619
+	}
+	return &s.shards[h%uint32(len(s.shards))]
+}
+
 func (s *memoryStore) Set(id string, digits []byte) {
-	s.Lock()
-	s.digitsById[id] = digits
-	s.idByTime.PushBack(idByTimeValue{time.Now(), id})
-	s.numStored++
-	if s.numStored <= s.collectNum {
-		s.Unlock()
+	s.setTTL(id, digits, 0)
+}
+
+// setTTL saves digits for the captcha id, which expire after ttl, or after
+// the store's expiration time if ttl is zero.
+func (s *memoryStore) setTTL(id string, digits []byte, ttl time.Duration) {
+	if ttl == 0 {
+		ttl = s.expiration
+	}
+	deadline := time.Now().Add(ttl)
+	sh := s.shard(id)
+	sh.Lock()
+	if it, ok := sh.byId[id]; ok {
+		it.digits = digits
+		it.deadline = deadline
+		it.attempts = 0
+		heap.Fix(&sh.byDeadline, it.index)
+	} else {
+		it := &memoryItem{id: id, digits: digits, deadline: deadline}
+		heap.Push(&sh.byDeadline, it)
+		sh.byId[id] = it
+		atomic.AddInt64(&s.numEntries, 1)
+	}
+	sh.Unlock()
+	if s.maxEntries > 0 {
+		s.evict(id)
+	}
+	if atomic.AddInt64(&s.numStored, 1) <= int64(s.collectNum) {
 		return
 	}
-	s.Unlock()
+	atomic.StoreInt64(&s.numStored, 0)
 	go s.collect()
 }
 
 func (s *memoryStore) Get(id string, clear bool) (digits []byte) {
+	digits, _ = s.get(id, clear)
+	return
+}
+
+// get returns digits for the captcha id, deleting the captcha if clear is
+// true. It returns ErrExpired for expired captchas that are not collected
+// yet.
+func (s *memoryStore) get(id string, clear bool) ([]byte, error) {
+	sh := s.shard(id)
 	if !clear {
 		// When we don't need to clear captcha, acquire read lock.
-		s.RLock()
-		defer s.RUnlock()
+		sh.RLock()
+		defer sh.RUnlock()
 	} else {
-		s.Lock()
-		defer s.Unlock()
+		sh.Lock()
+		defer sh.Unlock()
 	}
-	digits, ok := s.digitsById[id]
+	it, ok := sh.byId[id]
 	if !ok {
-		return
+		return nil, ErrNotFound
 	}
 	if clear {
-		delete(s.digitsById, id)
-		// XXX(dchest) Index (s.idByTime) will be cleaned when
-		// collecting expired captchas.  Can't clean it here, because
-		// we don't store reference to expValue in the map.
-		// Maybe store it?
+		delete(sh.byId, id)
+		heap.Remove(&sh.byDeadline, it.index)
+		atomic.AddInt64(&s.numEntries, -1)
 	}
-	return
+	if !time.Now().Before(it.deadline) {
+		return nil, ErrExpired
+	}
+	return it.digits, nil
 }
 
-func (s *memoryStore) collect() {
-	now := time.Now()
-	s.Lock()
-	defer s.Unlock()
-	s.numStored = 0
-	for e := s.idByTime.Front(); e != nil; {
-		ev, ok := e.Value.(idByTimeValue)
-		if !ok {
-			return
+// addAttempt increments the number of failed verification attempts of the
+// captcha and returns it.
+func (s *memoryStore) addAttempt(id string) (int, error) {
+	sh := s.shard(id)
+	sh.Lock()
+	defer sh.Unlock()
+	it, ok := sh.byId[id]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	if !time.Now().Before(it.deadline) {
+		return 0, ErrExpired
+	}
+	it.attempts++
+	return it.attempts, nil
+}
+
+// ttl returns the time left until the captcha expires.
+func (s *memoryStore) ttl(id string) (time.Duration, error) {
+	sh := s.shard(id)
+	sh.RLock()
+	defer sh.RUnlock()
+	it, ok := sh.byId[id]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	ttl := time.Until(it.deadline)
+	if ttl <= 0 {
+		return 0, ErrExpired
+	}
+	return ttl, nil
+}
+
+// evict deletes captchas closest to expiration, except the one with the
+// given id, while there are more captchas than the maximum.
+func (s *memoryStore) evict(except string) {
+	for atomic.LoadInt64(&s.numEntries) > int64(s.maxEntries) {
+		// Find the shard with the captcha closest to expiration.
+		var oldest *memoryShard
+		var deadline time.Time
+		for i := range s.shards {
+			sh := &s.shards[i]
+			sh.RLock()
+			if it := sh.evictable(except); it != nil && (oldest == nil || it.deadline.Before(deadline)) {
+				oldest, deadline = sh, it.deadline
+			}
+			sh.RUnlock()
 		}
-		if ev.timestamp.Add(s.expiration).Before(now) {
-			delete(s.digitsById, ev.id)
-			next := e.Next()
-			s.idByTime.Remove(e)
-			e = next
-		} else {
+		if oldest == nil {
 			return
 		}
+		// The shard may have changed since it was found, but it's not
+		// important which captcha is evicted in this case.
+		oldest.Lock()
+		if it := oldest.evictable(except); it != nil {
+			heap.Remove(&oldest.byDeadline, it.index)
+			delete(oldest.byId, it.id)
+			atomic.AddInt64(&s.numEntries, -1)
+		}
+		oldest.Unlock()
+	}
+}
+
+// evictable returns the captcha in the shard closest to expiration, except
+// the one with the given id, or nil if there is none.
+func (sh *memoryShard) evictable(except string) *memoryItem {
+	h := sh.byDeadline
+	if len(h) == 0 {
+		return nil
+	}
+	if h[0].id != except {
+		return h[0]
+	}
+	// The next captcha is one of the children of the excepted one.
+	var it *memoryItem
+	for _, c := range h[1:minInt(3, len(h))] {
+		if it == nil || c.deadline.Before(it.deadline) {
+			it = c
+		}
+	}
+	return it
+}
+
+func (s *memoryStore) collect() {
+	now := time.Now()
+	for i := range s.shards {
+		n := s.shards[i].collect(now)
+		atomic.AddInt64(&s.numEntries, -int64(n))
+	}
+}
+
+// collect deletes expired captchas from the shard and returns their number.
+func (sh *memoryShard) collect(now time.Time) int {
+	sh.Lock()
+	defer sh.Unlock()
+	n := 0
+	for len(sh.byDeadline) > 0 && !now.Before(sh.byDeadline[0].deadline) {
+		it := heap.Pop(&sh.byDeadline).(*memoryItem)
+		delete(sh.byId, it.id)
+		n++
 	}
+	return n
 }
@@ -6,9 +6,25 @@ package captcha
 
 import (
 	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unsafe"
 )
 
+func TestMemoryStoreAlignment(t *testing.T) {
+	// 64-bit atomic operations panic on 32-bit platforms if the field is
+	// not 64-bit aligned, which is guaranteed only for the first word.
+	if off := unsafe.Offsetof(memoryStore{}.numStored); off != 0 {
+		t.Errorf("numStored is at offset %d, expected 0", off)
+	}
+	if off := unsafe.Offsetof(memoryStore{}.numEntries); off != 8 {
+		t.Errorf("numEntries is at offset %d, expected 8", off)
+	}
+}
+
 func TestSetGet(t *testing.T) {
 	s := NewMemoryStore(CollectNum, Expiration)
 	id := "captcha id"
@@ -35,6 +51,34 @@ func TestGetClear(t *testing.T) {
 	}
 }
 
+func TestWrapStore(t *testing.T) {
+	ctx := context.Background()
+	s := WrapStore(NewMemoryStore(CollectNum, Expiration))
+	id := "captcha id"
+	d := RandomDigits(10)
+	if err := s.Set(ctx, id, d, Expiration); err != nil {
+		t.Fatal(err)
+	}
+	d2, err := s.Get(ctx, id)
+	if err != nil || !bytes.Equal(d, d2) {
+		t.Errorf("saved %v, Get returned %v, %v", d, d2, err)
+	}
+	d2, err = s.GetAndDelete(ctx, id)
+	if err != nil || !bytes.Equal(d, d2) {
+		t.Errorf("saved %v, GetAndDelete returned %v, %v", d, d2, err)
+	}
+	if _, err := s.Get(ctx, id); err != ErrNotFound {
+		t.Errorf("GetAndDelete didn't delete: expected ErrNotFound, got %v", err)
+	}
+	s.Set(ctx, id, d, Expiration)
+	if err := s.Delete(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetAndDelete(ctx, id); err != ErrNotFound {
+		t.Errorf("Delete didn't delete: expected ErrNotFound, got %v", err)
+	}
+}
+
 func TestCollect(t *testing.T) {
 	//TODO(dchest): can't test automatic collection when saving, because
 	//it's currently launched in a different goroutine.
@@ -61,6 +105,160 @@ func TestCollect(t *testing.T) {
 	}
 }
 
+func TestMaxEntries(t *testing.T) {
+	s := NewMemoryStoreWithOptions(MemoryStoreOptions{MaxEntries: 10, Shards: 1})
+	ids := make([]string, 15)
+	d := RandomDigits(10)
+	for i := range ids {
+		ids[i] = randomId()
+		s.Set(ids[i], d)
+	}
+	for i, id := range ids {
+		d2 := s.Get(id, false)
+		if i < 5 && d2 != nil {
+			t.Errorf("%d: oldest captcha not evicted", i)
+		}
+		if i >= 5 && d2 == nil {
+			t.Errorf("%d: new captcha evicted", i)
+		}
+	}
+	if n := len(s.(*memoryStore).shards[0].byDeadline); n != 10 {
+		t.Errorf("expected 10 items in index, got %d", n)
+	}
+}
+
+func TestMaxEntriesShards(t *testing.T) {
+	d := RandomDigits(10)
+	for _, max := range []int{1, 10, 100} {
+		// The limit is the same with the default number of shards.
+		s := NewMemoryStoreWithOptions(MemoryStoreOptions{MaxEntries: max})
+		ids := make([]string, 2*max)
+		for i := range ids {
+			ids[i] = randomId()
+			s.Set(ids[i], d)
+			if i == max-1 {
+				for j, id := range ids[:max] {
+					if s.Get(id, false) == nil {
+						t.Fatalf("MaxEntries %d: captcha %d evicted from store that is not full", max, j)
+					}
+				}
+			}
+		}
+		n := 0
+		for _, id := range ids {
+			if s.Get(id, false) != nil {
+				n++
+			}
+		}
+		if n != max {
+			t.Errorf("MaxEntries %d: got %d captchas", max, n)
+		}
+		if id := ids[len(ids)-1]; s.Get(id, false) == nil {
+			t.Errorf("MaxEntries %d: new captcha evicted", max)
+		}
+		s.Get(ids[len(ids)-1], true)
+		if n := atomic.LoadInt64(&s.(*memoryStore).numEntries); n != int64(max-1) {
+			t.Errorf("MaxEntries %d: counted %d captchas, expected %d", max, n, max-1)
+		}
+	}
+}
+
+func TestGetClearRemovesIndex(t *testing.T) {
+	s := NewMemoryStoreWithOptions(MemoryStoreOptions{Shards: 1})
+	id := randomId()
+	s.Set(id, RandomDigits(10))
+	s.Set(id, RandomDigits(10)) // reload
+	sh := &s.(*memoryStore).shards[0]
+	if n := len(sh.byDeadline); n != 1 {
+		t.Errorf("expected 1 item in index after reload, got %d", n)
+	}
+	s.Get(id, true)
+	if n := len(sh.byDeadline); n != 0 {
+		t.Errorf("expected empty index after clear, got %d", n)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStoreWithOptions(MemoryStoreOptions{Shards: 1})
+	w := WrapStore(s)
+	d := RandomDigits(10)
+	w.Set(ctx, "short", d, time.Millisecond)
+	w.Set(ctx, "long", d, time.Hour)
+	w.Set(ctx, "default", d, 0)
+	time.Sleep(2 * time.Millisecond)
+	// Not collected yet, but must not be returned.
+	if d2 := s.Get("short", false); d2 != nil {
+		t.Errorf("expired captcha returned")
+	}
+	if _, err := w.GetAndDelete(ctx, "short"); err != ErrExpired {
+		t.Errorf("expected ErrExpired for expired captcha, got %v", err)
+	}
+	if _, err := w.Get(ctx, "short"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for deleted captcha, got %v", err)
+	}
+	w.Set(ctx, "short", d, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	s.(*memoryStore).collect()
+	sh := &s.(*memoryStore).shards[0]
+	if _, ok := sh.byId["short"]; ok {
+		t.Errorf("expired captcha not collected")
+	}
+	for _, id := range []string{"long", "default"} {
+		if d2 := s.Get(id, false); d2 == nil {
+			t.Errorf("%s: captcha collected before expiration", id)
+		}
+	}
+	if exp := sh.byId["default"].deadline.Sub(time.Now()); exp <= Expiration-time.Minute {
+		t.Errorf("default expiration is not used: %v", exp)
+	}
+	ts := w.(TTLStore)
+	if ttl, err := ts.TTL(ctx, "long"); ttl <= time.Hour-time.Minute || ttl > time.Hour || err != nil {
+		t.Errorf("TTL: expected about an hour, got %v, %v", ttl, err)
+	}
+	if _, err := ts.TTL(ctx, "short"); err != ErrNotFound {
+		t.Errorf("TTL: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestEvictClosestToExpiration(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStoreWithOptions(MemoryStoreOptions{MaxEntries: 2, Shards: 1})
+	w := WrapStore(s)
+	d := RandomDigits(10)
+	w.Set(ctx, "long", d, time.Hour)
+	w.Set(ctx, "short", d, time.Minute)
+	w.Set(ctx, "new", d, time.Hour)
+	if s.Get("short", false) != nil {
+		t.Errorf("captcha closest to expiration not evicted")
+	}
+	if s.Get("long", false) == nil || s.Get("new", false) == nil {
+		t.Errorf("wrong captcha evicted")
+	}
+}
+
+func TestConcurrentSetGet(t *testing.T) {
+	s := NewMemoryStoreWithOptions(MemoryStoreOptions{MaxEntries: 100, CollectNum: 10})
+	d := RandomDigits(10)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				id := randomId()
+				s.Set(id, d)
+				s.Get(id, false)
+				s.Get(id, true)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt64(&s.(*memoryStore).numEntries); n != 0 {
+		t.Errorf("counted %d captchas in empty store", n)
+	}
+}
+
 func BenchmarkSetCollect(b *testing.B) {
 	b.StopTimer()
 	d := RandomDigits(10)
@@ -77,3 +275,15 @@ func BenchmarkSetCollect(b *testing.B) {
 		s.(*memoryStore).collect()
 	}
 }
+
+func BenchmarkParallelSetGet(b *testing.B) {
+	s := NewMemoryStoreWithOptions(MemoryStoreOptions{MaxEntries: 100000})
+	d := RandomDigits(10)
+	b.RunParallel(func(pb *testing.PB) {
+		id := randomId()
+		for pb.Next() {
+			s.Set(id, d)
+			s.Get(id, false)
+		}
+	})
+}
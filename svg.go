@@ -0,0 +1,186 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+)
+
+// SVGImage is a vector captcha image. It is drawn in the same way as Image:
+// digits made of dots, the strike-through line and noise circles, distorted
+// by a sine wave, but is encoded as SVG, so it stays crisp at any scale.
+//
+// Digits, strike-through lines and noise are all written as round dots,
+// grouped into paths by color and size, in random order, and some noise dots
+// look exactly like dots of digits, so the digits can't be read from the
+// document structure.
+type SVGImage struct {
+	width, height int
+	palette       color.Palette
+	dots          []svgDot
+}
+
+type svgPoint struct {
+	x, y float64
+}
+
+// svgDot is a round dot of the given diameter.
+type svgDot struct {
+	svgPoint
+	size     int
+	colorIdx uint8
+}
+
+// NewSVGImage returns a new vector captcha image of the given width and
+// height with the given digits. See NewImage for details.
+func NewSVGImage(id string, digits []byte, width, height int) *SVGImage {
+	return defaultManager.NewSVGImage(id, digits, width, height)
+}
+
+// newSVGImage returns a new vector captcha image with the given characters,
+// drawn with the given options and PRNG initialized from the given seed.
+func newSVGImage(seed [16]byte, chars []byte, width, height int, opts ImageOptions) *SVGImage {
+	// Image is used for its PRNG and size calculations; it has no pixels.
+	m := &Image{opts: opts}
+	m.rng.Seed(seed)
+	m.Paletted = &image.Paletted{
+		Rect:    image.Rect(0, 0, width, height),
+		Palette: m.getRandomPalette(),
+	}
+	s := &SVGImage{width: width, height: height, palette: m.Palette}
+
+	// Draw characters, as drawChars and drawDigit do.
+	fonts := m.chooseFonts(chars)
+	m.calculateSizes(width, height, len(chars))
+	x, y := m.charsPosition(width, height, len(chars))
+	for i, c := range chars {
+		f := fonts[i]
+		g := f.glyph(c)
+		skf := m.rng.Float(-opts.MaxSkew, opts.MaxSkew)
+		gd := m.glyphDotSize(f)
+		xs := float64(x + (m.cellWidth*m.dotSize-f.width*gd)/2)
+		r := m.dotSize / 2
+		yd := y + (m.cellHeight*m.dotSize-f.height*gd)/2 + m.rng.Int(-r, r)
+		for yo := 0; yo < f.height; yo++ {
+			for xo := 0; xo < f.width; xo++ {
+				if g[yo*f.width+xo] == blackChar {
+					p := svgPoint{xs + float64(xo*gd), float64(yd + yo*gd)}
+					s.dots = append(s.dots, svgDot{p, gd/2*2 + 1, 1})
+				}
+			}
+			xs += skf
+		}
+		x += m.numWidth + m.dotSize
+	}
+	glyphDots := s.dots
+
+	// Draw strike-through lines as bands of dots, as drawStrikeLine does.
+	step := maxInt(m.dotSize/2, 1)
+	for i := 0; i < opts.StrikeLines; i++ {
+		l := m.randomStrikeLine()
+		dx := 2.0 * math.Pi / l.period
+		xo := l.amplitude * math.Cos(float64(l.y)*dx)
+		for x := 0; x <= width; x += step {
+			yo := l.amplitude * math.Sin(float64(x)*dx)
+			for yn := 0; yn < m.dotSize; yn++ {
+				p := svgPoint{float64(x) + xo, float64(l.y+yn*m.dotSize) + yo}
+				s.dots = append(s.dots, svgDot{p, m.dotSize/2*2 + 1, 1})
+			}
+		}
+	}
+
+	// Apply wave distortion to digits and lines. Image.distort moves
+	// pixels backwards, so points are moved by the opposite offsets.
+	amplitude, period := m.rng.Float(opts.MinDistortion, opts.MaxDistortion), m.rng.Float(100, 200)
+	for i, d := range s.dots {
+		s.dots[i].svgPoint = distortPoint(d.svgPoint, amplitude, period)
+	}
+
+	// Add random circles, as fillWithCircles does. Every other circle is
+	// a decoy: a dot of the same color and size as dots of digits.
+	maxr := m.maxCircleRadius()
+	for i := 0; i < opts.Circles; i++ {
+		var d svgDot
+		if i%2 == 0 && len(glyphDots) > 0 {
+			d = glyphDots[m.rng.Intn(len(glyphDots))]
+		} else {
+			d.colorIdx = uint8(m.rng.Int(1, circleCount-1))
+			d.size = m.rng.Int(1, maxr)*2 + 1
+		}
+		r := d.size / 2
+		d.x = float64(m.rng.Int(r, width-r))
+		d.y = float64(m.rng.Int(r, height-r))
+		s.dots = append(s.dots, d)
+	}
+
+	// Shuffle dots, so that their order doesn't reveal digits.
+	for i := len(s.dots) - 1; i > 0; i-- {
+		j := m.rng.Intn(i + 1)
+		s.dots[i], s.dots[j] = s.dots[j], s.dots[i]
+	}
+	return s
+}
+
+func distortPoint(p svgPoint, amplitude, period float64) svgPoint {
+	dx := 2.0 * math.Pi / period
+	return svgPoint{
+		p.x - amplitude*math.Sin(p.y*dx),
+		p.y - amplitude*math.Cos(p.x*dx),
+	}
+}
+
+func svgColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+func svgNum(v float64) string {
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+// WriteTo writes captcha image in SVG format into the given writer.
+func (s *SVGImage) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		s.width, s.height, s.width, s.height)
+	if _, _, _, a := s.palette[0].RGBA(); a != 0 {
+		fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"/>`, svgColor(s.palette[0]))
+	}
+	// Dots are zero-length lines with round caps, in one path for each
+	// color and size of dots.
+	type style struct {
+		size     int
+		colorIdx uint8
+	}
+	var styles []style
+	for _, d := range s.dots {
+		st := style{d.size, d.colorIdx}
+		found := false
+		for _, o := range styles {
+			found = found || o == st
+		}
+		if !found {
+			styles = append(styles, st)
+		}
+	}
+	for _, st := range styles {
+		fmt.Fprintf(&buf, `<path fill="none" stroke="%s" stroke-width="%d" stroke-linecap="round" d="`,
+			svgColor(s.palette[st.colorIdx]), st.size)
+		for _, d := range s.dots {
+			if d.size == st.size && d.colorIdx == st.colorIdx {
+				fmt.Fprintf(&buf, "M%s %sh0", svgNum(d.x), svgNum(d.y))
+			}
+		}
+		buf.WriteString(`"/>`)
+	}
+	buf.WriteString("</svg>\n")
+	return buf.WriteTo(w)
+}
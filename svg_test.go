@@ -0,0 +1,111 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSVGImage(t *testing.T) {
+	m := NewManager(Config{})
+	id := m.New()
+	var b1, b2 bytes.Buffer
+	if err := m.WriteSVGImage(&b1, id, StdWidth, StdHeight); err != nil {
+		t.Fatal(err)
+	}
+	m.WriteSVGImage(&b2, id, StdWidth, StdHeight)
+	if !bytes.Equal(b1.Bytes(), b2.Bytes()) {
+		t.Errorf("SVG images of the same captcha are different")
+	}
+	// Must be well-formed XML without text, with everything drawn by
+	// paths, so that noise is not told apart from digits by elements.
+	d := xml.NewDecoder(bytes.NewReader(b1.Bytes()))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("bad XML: %v", err)
+		}
+		if cd, ok := tok.(xml.CharData); ok && strings.TrimSpace(string(cd)) != "" {
+			t.Errorf("SVG contains text %q", cd)
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			switch se.Name.Local {
+			case "svg", "rect", "path":
+			default:
+				t.Errorf("SVG contains %s element", se.Name.Local)
+			}
+		}
+	}
+}
+
+func TestSVGImageDots(t *testing.T) {
+	digits := []byte{1, 1, 1, 1, 1, 1}
+	opts := DefaultImage
+	opts.StrikeLines = 0
+	opts.Circles = 0
+	s := newSVGImage([16]byte{1}, defaultManager.renderedChars(digits), StdWidth, StdHeight, opts)
+	n := 0
+	for _, v := range font[1] {
+		if v == blackChar {
+			n++
+		}
+	}
+	if len(s.dots) != n*len(digits) {
+		t.Fatalf("expected %d dots, got %d", n*len(digits), len(s.dots))
+	}
+	// Dots of the first digit must not come first.
+	maxx := 0.0
+	for _, p := range s.dots[:n] {
+		if p.x > maxx {
+			maxx = p.x
+		}
+	}
+	if maxx < float64(StdWidth)/2 {
+		t.Errorf("dots are not shuffled")
+	}
+}
+
+func TestSVGImageDecoys(t *testing.T) {
+	chars := defaultManager.renderedChars([]byte{1, 2, 3, 4, 5, 6})
+	opts := DefaultImage
+	opts.StrikeLines = 0
+	opts.Circles = 0
+	clean := newSVGImage([16]byte{1}, chars, StdWidth, StdHeight, opts)
+	opts.Circles = 20
+	s := newSVGImage([16]byte{1}, chars, StdWidth, StdHeight, opts)
+	// Some noise must be indistinguishable from dots of digits.
+	dot := clean.dots[0]
+	n := 0
+	for _, d := range s.dots {
+		if d.colorIdx == dot.colorIdx && d.size == dot.size {
+			n++
+		}
+	}
+	if n < len(clean.dots)+opts.Circles/2 {
+		t.Errorf("expected at least %d decoy dots, got %d", opts.Circles/2, n-len(clean.dots))
+	}
+}
+
+func TestServerSVGImage(t *testing.T) {
+	m := NewManager(Config{})
+	id := m.New()
+	w := httptest.NewRecorder()
+	m.Server().ServeHTTP(w, httptest.NewRequest("GET", "/captcha/"+id+".svg", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/svg+xml" {
+		t.Errorf("expected image/svg+xml content type, got %q", ct)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+)
+
+// Tokens are an alternative to storing captchas: the solution and expiration
+// time are encrypted and authenticated with the manager's secret key, and the
+// resulting token is given to the client instead of an id. The client sends
+// it back with the solution, so servers don't need a store to verify it.
+//
+// Token format (encoded in URL-safe base64 without padding):
+//
+//	nonce || AES-GCM(tokenKey, nonce, expires || digits)
+//
+// where tokenKey = HMAC(key, "captcha token key"), expires is 8-byte
+// big-endian Unix time in seconds, and nonce is 12 random bytes.
+
+const tokenNonceSize = 12
+
+// minTokenLen is the length of encoded token with empty solution. Tokens are
+// longer than ids, which is used to tell them apart.
+const minTokenLen = (tokenNonceSize + 8 + 16) * 4 / 3
+
+// newTokenAEAD returns AEAD used to encrypt tokens with keys derived from the
+// secret key.
+func newTokenAEAD(key []byte) cipher.AEAD {
+	h := hmac.New(sha256.New, key)
+	io.WriteString(h, "captcha token key")
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		panic("captcha: " + err.Error())
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic("captcha: " + err.Error())
+	}
+	return aead
+}
+
+// spentTokens remembers nonces of verified tokens until they expire, so
+// that each token can be verified only once.
+type spentTokens struct {
+	sync.Mutex
+	expires map[[tokenNonceSize]byte]int64
+	// Number of nonces that triggers removal of expired ones.
+	collectAt int
+}
+
+// spend marks the nonce as spent until the given time, and returns false if
+// it has been already spent.
+func (s *spentTokens) spend(nonce []byte, expires int64, now int64) bool {
+	var n [tokenNonceSize]byte
+	copy(n[:], nonce)
+	s.Lock()
+	defer s.Unlock()
+	if s.expires == nil {
+		s.expires = make(map[[tokenNonceSize]byte]int64)
+	}
+	if _, ok := s.expires[n]; ok {
+		return false
+	}
+	s.expires[n] = expires
+	if len(s.expires) >= s.collectAt {
+		for k, e := range s.expires {
+			if e < now {
+				delete(s.expires, k)
+			}
+		}
+		s.collectAt = 2 * len(s.expires)
+		if s.collectAt < CollectNum {
+			s.collectAt = CollectNum
+		}
+	}
+	return true
+}
+
+// NewToken creates a new captcha with the default length and returns a token
+// containing its encrypted solution. The captcha is not saved in the store.
+//
+// Tokens can be used instead of ids with WriteImage, WriteAudio and Server.
+// As tokens are not stored, they can't be reloaded: to show a different
+// captcha, create a new token.
+func (m *Manager) NewToken() string {
+	return m.NewTokenLen(m.defaultLen)
+}
+
+// NewTokenLen is just like NewToken, but accepts length of a captcha solution
+// as the argument.
+func (m *Manager) NewTokenLen(length int) string {
+	exp := m.expiration
+	if exp == 0 {
+		exp = Expiration
+	}
+	return m.sealToken(m.alphabet.Random(length), time.Now().Add(exp))
+}
+
+func (m *Manager) sealToken(digits []byte, expires time.Time) string {
+	aead := m.keys[0].aead
+	plaintext := make([]byte, 8+len(digits))
+	binary.BigEndian.PutUint64(plaintext, uint64(expires.Unix()))
+	copy(plaintext[8:], digits)
+	nonce := randomBytes(tokenNonceSize)
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil))
+}
+
+// openToken decrypts the token and returns its nonce, expiration time and
+// digits. It returns ErrNotFound if the token is invalid or expired.
+func (m *Manager) openToken(token string, now time.Time) (nonce []byte, expires int64, digits []byte, err error) {
+	_, nonce, plaintext := m.tokenKey(token)
+	if plaintext == nil {
+		return nil, 0, nil, ErrNotFound
+	}
+	expires = int64(binary.BigEndian.Uint64(plaintext))
+	if expires < now.Unix() {
+		return nil, 0, nil, ErrNotFound
+	}
+	return nonce, expires, plaintext[8:], nil
+}
+
+// tokenKey returns the key that the token was sealed with, its nonce and
+// decrypted plaintext, or nil key and plaintext if the token is invalid.
+func (m *Manager) tokenKey(token string) (k *secretKey, nonce, plaintext []byte) {
+	if len(token) < minTokenLen {
+		return nil, nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, nil, nil
+	}
+	nonce, ciphertext := b[:tokenNonceSize], b[tokenNonceSize:]
+	for i := range m.keys {
+		k := &m.keys[i]
+		plaintext, err := k.aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil || len(plaintext) < 8 {
+			continue
+		}
+		return k, nonce, plaintext
+	}
+	return nil, nil, nil
+}
+
+// isToken returns true if id is long enough to be a token.
+func isToken(id string) bool {
+	return len(id) >= minTokenLen
+}
+
+// VerifyToken returns true if the given digits are the solution of the
+// captcha in the given token, and the token has not expired.
+//
+// Each token can be verified only once by this manager: the function
+// remembers verified tokens until they expire. The memory of verified tokens
+// is not shared between managers, so applications that run several servers
+// must make sure that tokens are verified by the same server, or use the
+// store.
+func (m *Manager) VerifyToken(token string, digits []byte) bool {
+	if digits == nil || len(digits) == 0 {
+		return false
+	}
+	now := time.Now()
+	nonce, expires, reald, err := m.openToken(token, now)
+	if err != nil {
+		equalDigits(digits, dummyDigits)
+		return false
+	}
+	if !m.spent.spend(nonce, expires, now.Unix()) {
+		equalDigits(digits, dummyDigits)
+		return false
+	}
+	return equalDigits(digits, answerOf(reald))
+}
+
+// VerifyTokenString is like VerifyToken, but accepts a string of digits. See
+// VerifyString for details.
+func (m *Manager) VerifyTokenString(token string, digits string) bool {
+	ns, ok := m.alphabet.Parse(digits)
+	if !ok {
+		return false
+	}
+	return m.VerifyToken(token, ns)
+}
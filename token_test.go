@@ -0,0 +1,136 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// tokenDigits returns digits from the token.
+func tokenDigits(t *testing.T, m *Manager, token string) []byte {
+	_, _, d, err := m.openToken(token, time.Now())
+	if err != nil {
+		t.Fatalf("openToken: %v", err)
+	}
+	return d
+}
+
+func TestToken(t *testing.T) {
+	m := NewManager(Config{Store: brokenStore{}})
+	token := m.NewToken()
+	if !isToken(token) || isToken(m.newId()) {
+		t.Fatalf("tokens and ids can't be told apart")
+	}
+	d := tokenDigits(t, m, token)
+	if len(d) != DefaultLen {
+		t.Errorf("expected %d digits, got %d", DefaultLen, len(d))
+	}
+	if !m.VerifyToken(token, d) {
+		t.Errorf("proper token not verified")
+	}
+	if m.VerifyToken(token, d) {
+		t.Errorf("token verified twice")
+	}
+	token = m.NewTokenLen(4)
+	d = tokenDigits(t, m, token)
+	if m.VerifyToken(token, []byte{0, 0}) {
+		t.Errorf("verified wrong solution")
+	}
+	if m.VerifyToken(token, d) {
+		t.Errorf("token verified after wrong solution")
+	}
+}
+
+func TestTokenInvalid(t *testing.T) {
+	m := NewManager(Config{})
+	d := RandomDigits(DefaultLen)
+	expired := m.sealToken(d, time.Now().Add(-time.Second))
+	if m.VerifyToken(expired, d) {
+		t.Errorf("expired token verified")
+	}
+	token := m.sealToken(d, time.Now().Add(time.Minute))
+	tampered := []byte(token)
+	if tampered[20] == 'A' {
+		tampered[20] = 'B'
+	} else {
+		tampered[20] = 'A'
+	}
+	if m.VerifyToken(string(tampered), d) {
+		t.Errorf("tampered token verified")
+	}
+	if NewManager(Config{}).VerifyToken(token, d) {
+		t.Errorf("token verified by manager with different key")
+	}
+	if m.VerifyToken("short", d) || m.VerifyToken(token[:minTokenLen], d) {
+		t.Errorf("truncated token verified")
+	}
+}
+
+func TestTokenKeyRotation(t *testing.T) {
+	key1 := []byte("0123456789abcdef0123456789abcdef")
+	key2 := []byte("fedcba9876543210fedcba9876543210")
+	m1 := NewManager(Config{Key: key1})
+	token := m1.NewToken()
+	d := tokenDigits(t, m1, token)
+	m2 := NewManager(Config{Key: key2, PreviousKeys: [][]byte{key1}})
+	if !m2.VerifyTokenString(token, digitsToString(d)) {
+		t.Errorf("token created with previous key not verified")
+	}
+	if NewManager(Config{Key: key2}).VerifyToken(m1.NewToken(), d) {
+		t.Errorf("token created with unknown key verified")
+	}
+	// Tokens keep their look after rotation.
+	for i := 0; i < 50; i++ {
+		token := m1.NewToken()
+		d := tokenDigits(t, m1, token)
+		if m1.deriveSeed(imageSeedPurpose, token, d) != m2.deriveSeed(imageSeedPurpose, token, d) {
+			t.Fatalf("token %q is rendered differently after rotation", token)
+		}
+	}
+}
+
+func digitsToString(d []byte) string {
+	s := make([]byte, len(d))
+	for i, v := range d {
+		s[i] = v + '0'
+	}
+	return string(s)
+}
+
+func TestTokenServer(t *testing.T) {
+	m := NewManager(Config{Store: brokenStore{}})
+	token := m.NewToken()
+	var b bytes.Buffer
+	if err := m.WriteImageContext(context.Background(), &b, token, StdWidth, StdHeight); err != nil {
+		t.Fatalf("WriteImage: %v", err)
+	}
+	w := httptest.NewRecorder()
+	m.Server().ServeHTTP(w, httptest.NewRequest("GET", "/captcha/"+token+".png", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if !bytes.Equal(w.Body.Bytes(), b.Bytes()) {
+		t.Errorf("server rendered different image for token")
+	}
+}
+
+func TestSpentTokensCollect(t *testing.T) {
+	var s spentTokens
+	now := time.Now().Unix()
+	for i := 0; i <= CollectNum; i++ {
+		nonce := randomBytes(tokenNonceSize)
+		if !s.spend(nonce, now-1, now) {
+			t.Fatalf("fresh nonce reported as spent")
+		}
+	}
+	if len(s.expires) != 0 {
+		t.Errorf("expired nonces not collected: %d left", len(s.expires))
+	}
+}
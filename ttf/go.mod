@@ -0,0 +1,13 @@
+module github.com/dchest/captcha/ttf
+
+go 1.18
+
+require (
+	github.com/dchest/captcha v0.0.0-00010101000000-000000000000
+	golang.org/x/image v0.18.0
+)
+
+require golang.org/x/text v0.16.0 // indirect
+
+// Build with the captcha package from this repository.
+replace github.com/dchest/captcha => ../
@@ -0,0 +1,284 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package ttf draws captcha characters with TrueType and OpenType fonts.
+//
+// Glyphs are randomly rotated, scaled and overlapped, and then the captcha
+// package adds strike-through lines, wave distortion and noise as usual.
+// Renderer is set in image options of the captcha package:
+//
+//	r, err := ttf.New([][]byte{fontData}, nil)
+//	if err != nil {
+//		...
+//	}
+//	opts := captcha.DefaultImage
+//	opts.Renderer = r
+//	m := captcha.NewManager(captcha.Config{ImageOptions: &opts})
+//
+// It lives in a separate module, so that the captcha module doesn't depend
+// on font parsing code.
+package ttf
+
+import (
+	"errors"
+	"image"
+	"io/fs"
+	"math"
+	"math/rand"
+
+	"github.com/dchest/captcha"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// Options describe how glyphs are drawn.
+type Options struct {
+	// MaxRotation is the maximum absolute rotation of glyphs in degrees.
+	MaxRotation float64
+	// MinScale and MaxScale are the range of sizes of glyphs relative to
+	// the largest size that fits into a character's cell.
+	MinScale float64
+	MaxScale float64
+	// Overlap is the part of the width of a character's cell that is
+	// overlapped by the neighbouring cell, from 0 to 0.5.
+	Overlap float64
+	// Border is the part of the smaller side of the image kept free
+	// around characters, from 0 to 0.5 (exclusive).
+	Border float64
+}
+
+// DefaultOptions are used if no options are given to New.
+var DefaultOptions = Options{
+	MaxRotation: 30,
+	MinScale:    0.75,
+	MaxScale:    1,
+	Overlap:     0.2,
+	Border:      0.1,
+}
+
+func (o *Options) validate() error {
+	switch {
+	case o.MaxRotation < 0:
+		return errors.New("ttf: negative rotation")
+	case o.MinScale <= 0 || o.MinScale > o.MaxScale:
+		return errors.New("ttf: bad range of scale")
+	case o.Overlap < 0 || o.Overlap > 0.5:
+		return errors.New("ttf: overlap must be in range [0, 0.5]")
+	case o.Border < 0 || o.Border >= 0.5:
+		return errors.New("ttf: border must be in range [0, 0.5)")
+	}
+	return nil
+}
+
+// Renderer draws captcha characters with fonts. It implements
+// captcha.CharRenderer. It is safe for concurrent use.
+type Renderer struct {
+	fonts []*sfnt.Font
+	opts  Options
+}
+
+// New returns a new renderer using the given fonts, which are TrueType or
+// OpenType fonts or collections. The font of each character is chosen
+// randomly among fonts that have its glyph; characters without glyphs in any
+// of them are drawn with dots of captcha.DefaultFont. Each font must have
+// glyphs of digits. If opts is nil, DefaultOptions are used.
+func New(fonts [][]byte, opts *Options) (*Renderer, error) {
+	r := &Renderer{opts: DefaultOptions}
+	if opts != nil {
+		r.opts = *opts
+	}
+	if err := r.opts.validate(); err != nil {
+		return nil, err
+	}
+	var buf sfnt.Buffer
+	for _, data := range fonts {
+		c, err := sfnt.ParseCollection(data)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < c.NumFonts(); i++ {
+			f, err := c.Font(i)
+			if err != nil {
+				return nil, err
+			}
+			for d := '0'; d <= '9'; d++ {
+				if gi, err := f.GlyphIndex(&buf, d); err != nil || gi == 0 {
+					return nil, errors.New("ttf: font has no glyphs of digits")
+				}
+			}
+			r.fonts = append(r.fonts, f)
+		}
+	}
+	if len(r.fonts) == 0 {
+		return nil, errors.New("ttf: no fonts")
+	}
+	return r, nil
+}
+
+// NewFS is like New, but reads fonts from files in fsys, such as embed.FS,
+// with names matching any of the given patterns (see fs.Glob). If there are
+// no patterns, it reads files matching "*.ttf", "*.otf" and "*.ttc".
+func NewFS(fsys fs.FS, opts *Options, patterns ...string) (*Renderer, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"*.ttf", "*.otf", "*.ttc"}
+	}
+	var fonts [][]byte
+	for _, p := range patterns {
+		names, err := fs.Glob(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil, err
+			}
+			fonts = append(fonts, data)
+		}
+	}
+	return New(fonts, opts)
+}
+
+// runes returns runes that may be used to draw the character, in order of
+// preference.
+func runes(c byte) []rune {
+	switch c {
+	case '*':
+		return []rune{'×', 'x'}
+	case '-':
+		return []rune{'−', '-'}
+	}
+	return []rune{rune(c)}
+}
+
+// glyph returns segments of the glyph of the character in a randomly chosen
+// font in font units. If no font has it, it returns the glyph of
+// captcha.DefaultFont, or nil if there's no such glyph either.
+func (r *Renderer) glyph(buf *sfnt.Buffer, c byte, rng *rand.Rand) sfnt.Segments {
+	type candidate struct {
+		f  *sfnt.Font
+		gi sfnt.GlyphIndex
+	}
+	var candidates []candidate
+	for _, f := range r.fonts {
+		for _, rn := range runes(c) {
+			if gi, err := f.GlyphIndex(buf, rn); err == nil && gi != 0 {
+				candidates = append(candidates, candidate{f, gi})
+				break
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return dotGlyph(captcha.DefaultFont, c)
+	}
+	g := candidates[0]
+	if len(candidates) > 1 {
+		g = candidates[rng.Intn(len(candidates))]
+	}
+	segs, err := g.f.LoadGlyph(buf, g.gi, fixed.I(int(g.f.UnitsPerEm())), nil)
+	if err != nil {
+		return nil
+	}
+	return segs
+}
+
+// dotGlyph returns segments of squares of dots of the character's glyph in
+// the dot-matrix font, or nil if the font has no such glyph.
+func dotGlyph(f *captcha.Font, c byte) sfnt.Segments {
+	var segs sfnt.Segments
+	seg := func(op sfnt.SegmentOp, x, y int) {
+		segs = append(segs, sfnt.Segment{Op: op, Args: [3]fixed.Point26_6{fixed.P(x, y)}})
+	}
+	for y := 0; y < f.Height(); y++ {
+		for x := 0; x < f.Width(); x++ {
+			if f.Dot(c, x, y) {
+				seg(sfnt.SegmentOpMoveTo, x, y)
+				seg(sfnt.SegmentOpLineTo, x+1, y)
+				seg(sfnt.SegmentOpLineTo, x+1, y+1)
+				seg(sfnt.SegmentOpLineTo, x, y+1)
+			}
+		}
+	}
+	return segs
+}
+
+// DrawChars draws the characters on the image with color index 1.
+func (r *Renderer) DrawChars(m *image.Paletted, chars []byte, rng *rand.Rand) {
+	if len(chars) == 0 {
+		return
+	}
+	b := m.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+	border := math.Min(w, h) * r.opts.Border
+	n := float64(len(chars))
+	// Size of a character's cell.
+	cw := (w - 2*border) / (n - (n-1)*r.opts.Overlap)
+	ch := h - 2*border
+
+	z := vector.NewRasterizer(b.Dx(), b.Dy())
+	mask := image.NewAlpha(image.Rect(0, 0, b.Dx(), b.Dy()))
+	var buf sfnt.Buffer
+	for i, c := range chars {
+		segs := r.glyph(&buf, c, rng)
+		if segs == nil {
+			continue
+		}
+		gb := segs.Bounds()
+		gw := float64(gb.Max.X-gb.Min.X) / 64
+		gh := float64(gb.Max.Y-gb.Min.Y) / 64
+		if gw <= 0 || gh <= 0 {
+			continue
+		}
+		// Center of the glyph in font units.
+		gx := float64(gb.Min.X+gb.Max.X) / 128
+		gy := float64(gb.Min.Y+gb.Max.Y) / 128
+
+		scale := r.opts.MinScale + rng.Float64()*(r.opts.MaxScale-r.opts.MinScale)
+		s := scale * math.Min(cw/gw, ch/gh)
+		sin, cos := math.Sincos((2*rng.Float64() - 1) * r.opts.MaxRotation * math.Pi / 180)
+		// Center of the glyph in the image, moved randomly up or down
+		// within the cell.
+		cx := border + cw*float64(i)*(1-r.opts.Overlap) + cw/2
+		cy := h/2 + (2*rng.Float64()-1)*(ch-gh*s)/2
+
+		tr := func(p fixed.Point26_6) (float32, float32) {
+			x := (float64(p.X)/64 - gx) * s
+			y := (float64(p.Y)/64 - gy) * s
+			return float32(cx + x*cos - y*sin), float32(cy + x*sin + y*cos)
+		}
+		z.Reset(b.Dx(), b.Dy())
+		for j, seg := range segs {
+			switch seg.Op {
+			case sfnt.SegmentOpMoveTo:
+				if j > 0 {
+					z.ClosePath()
+				}
+				z.MoveTo(tr(seg.Args[0]))
+			case sfnt.SegmentOpLineTo:
+				z.LineTo(tr(seg.Args[0]))
+			case sfnt.SegmentOpQuadTo:
+				x1, y1 := tr(seg.Args[0])
+				x2, y2 := tr(seg.Args[1])
+				z.QuadTo(x1, y1, x2, y2)
+			case sfnt.SegmentOpCubeTo:
+				x1, y1 := tr(seg.Args[0])
+				x2, y2 := tr(seg.Args[1])
+				x3, y3 := tr(seg.Args[2])
+				z.CubeTo(x1, y1, x2, y2, x3, y3)
+			}
+		}
+		z.ClosePath()
+		z.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+	}
+	// Paletted images have no antialiasing, so pixels covered by glyphs
+	// at least by half are drawn.
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			if mask.AlphaAt(x, y).A >= 0x80 {
+				m.SetColorIndex(b.Min.X+x, b.Min.Y+y, 1)
+			}
+		}
+	}
+}
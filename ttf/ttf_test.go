@@ -0,0 +1,120 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package ttf
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dchest/captcha"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func newPaletted() *image.Paletted {
+	return image.NewPaletted(image.Rect(0, 0, captcha.StdWidth, captcha.StdHeight),
+		color.Palette{color.Transparent, color.Black})
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(nil, nil); err == nil {
+		t.Errorf("expected error for no fonts")
+	}
+	if _, err := New([][]byte{[]byte("not a font")}, nil); err == nil {
+		t.Errorf("expected error for bad font")
+	}
+	if _, err := New([][]byte{goregular.TTF}, &Options{MinScale: 1, MaxScale: 0.5}); err == nil {
+		t.Errorf("expected error for bad options")
+	}
+	r, err := NewFS(fstest.MapFS{
+		"a.ttf":      {Data: goregular.TTF},
+		"b.ttf":      {Data: gomono.TTF},
+		"readme.txt": {Data: []byte("not a font")},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.fonts) != 2 {
+		t.Errorf("expected 2 fonts, got %d", len(r.fonts))
+	}
+}
+
+func TestDrawChars(t *testing.T) {
+	r, err := New([][]byte{goregular.TTF, gomono.TTF}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, m2 := newPaletted(), newPaletted()
+	r.DrawChars(m1, []byte("12*3=4"), rand.New(rand.NewSource(1)))
+	r.DrawChars(m2, []byte("12*3=4"), rand.New(rand.NewSource(1)))
+	if !bytes.Equal(m1.Pix, m2.Pix) {
+		t.Errorf("images drawn with the same rng are different")
+	}
+	// Glyphs must be drawn inside the border, in every part of the image.
+	var left, right, edges int
+	for y := 0; y < m1.Rect.Dy(); y++ {
+		for x := 0; x < m1.Rect.Dx(); x++ {
+			if m1.ColorIndexAt(x, y) != 1 {
+				continue
+			}
+			if x < m1.Rect.Dx()/2 {
+				left++
+			} else {
+				right++
+			}
+			if x < 4 || y < 4 || x >= m1.Rect.Dx()-4 || y >= m1.Rect.Dy()-4 {
+				edges++
+			}
+		}
+	}
+	if left == 0 || right == 0 {
+		t.Errorf("glyphs are not drawn")
+	}
+	if edges != 0 {
+		t.Errorf("%d pixels drawn on the border", edges)
+	}
+}
+
+func TestDrawCharsFallback(t *testing.T) {
+	// Without fonts, all characters are drawn with captcha.DefaultFont.
+	r := &Renderer{opts: DefaultOptions}
+	m := newPaletted()
+	r.DrawChars(m, []byte("12"), rand.New(rand.NewSource(1)))
+	n := 0
+	for _, c := range m.Pix {
+		if c == 1 {
+			n++
+		}
+	}
+	if n == 0 {
+		t.Errorf("characters without glyphs are not drawn")
+	}
+	if dotGlyph(captcha.DefaultFont, 'a') != nil {
+		t.Errorf("expected no glyph for character missing in font")
+	}
+}
+
+func TestCaptchaImage(t *testing.T) {
+	r, err := New([][]byte{goregular.TTF}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := captcha.DefaultImage
+	opts.Renderer = r
+	m := captcha.NewManager(captcha.Config{ImageOptions: &opts})
+	id := m.New()
+	var b1, b2 bytes.Buffer
+	if err := m.WriteImage(&b1, id, captcha.StdWidth, captcha.StdHeight); err != nil {
+		t.Fatal(err)
+	}
+	m.WriteImage(&b2, id, captcha.StdWidth, captcha.StdHeight)
+	if !bytes.Equal(b1.Bytes(), b2.Bytes()) {
+		t.Errorf("images of the same captcha are different")
+	}
+}
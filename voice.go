@@ -0,0 +1,421 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Limits of duration of registered sounds, in samples at sampleRate.
+const (
+	minVoiceSoundLen = sampleRate / 20 // 50 ms
+	maxVoiceSoundLen = sampleRate * 2  // 2 seconds
+)
+
+// speaker is a set of sounds of digits recorded by one person. Each digit
+// has one or more takes.
+type speaker struct {
+	digits [][][]int16
+}
+
+// voice is a set of sounds that pronounce characters in a language.
+// Registered voices are not modified, but cache their resampled copies.
+type voice struct {
+	speakers  []*speaker
+	operators [][][]int16 // takes of operators, nil if they can't be pronounced
+	rate      int         // sample rate of sounds
+
+	// Voices with sounds resampled to other sample rates.
+	ratesMu sync.Mutex
+	rates   map[int]*voice
+}
+
+var (
+	voicesMu   sync.RWMutex
+	voices     = make(map[string]*voice)
+	voicesOnce sync.Once
+)
+
+// Sounds of beeps at the beginning and the end of audio, by sample rate.
+var (
+	beepsMu sync.Mutex
+	beeps   = make(map[int][2][]int16)
+)
+
+// initVoices decodes built-in sounds when they are used for the first
+// time, so that programs that don't create audio don't spend time on it.
+func initVoices() {
+	voicesOnce.Do(func() {
+		// Built-in sounds are 8 kHz unsigned 8-bit PCM data.
+		voicesMu.Lock()
+		defer voicesMu.Unlock()
+		for lang, sounds := range digitSounds {
+			voices[lang] = &voice{speakers: []*speaker{{digits: pcm8Samples(sounds)}}, rate: 8000}
+		}
+		for lang, sounds := range operatorSounds {
+			voices[lang].operators = pcm8Samples(sounds)
+		}
+	})
+}
+
+// pcm8Samples converts unsigned 8-bit sounds to single takes of samples.
+func pcm8Samples(sounds [][]byte) [][][]int16 {
+	s := make([][][]int16, len(sounds))
+	for i, b := range sounds {
+		s[i] = [][]int16{decodePCM8(b)}
+	}
+	return s
+}
+
+// atRate returns the voice with sounds resampled to the given sample rate.
+// Resampled voices are cached, since audio is usually created with the same
+// options.
+func (v *voice) atRate(rate int) *voice {
+	if rate == v.rate {
+		return v
+	}
+	v.ratesMu.Lock()
+	defer v.ratesMu.Unlock()
+	if nv, ok := v.rates[rate]; ok {
+		return nv
+	}
+	r := newResampler(v.rate, rate)
+	nv := &voice{operators: resampleTakes(r, v.operators, v.rate, rate), rate: rate}
+	for _, sp := range v.speakers {
+		nv.speakers = append(nv.speakers, &speaker{digits: resampleTakes(r, sp.digits, v.rate, rate)})
+	}
+	if v.rates == nil {
+		v.rates = make(map[int]*voice)
+	}
+	v.rates[rate] = nv
+	return nv
+}
+
+// resampleTakes returns takes of sounds converted from one sample rate to
+// another with the resampler.
+func resampleTakes(r *resampler, sounds [][][]int16, from, to int) [][][]int16 {
+	if sounds == nil {
+		return nil
+	}
+	s := make([][][]int16, len(sounds))
+	for i, takes := range sounds {
+		for _, t := range takes {
+			b := make([]int16, resampledLen(len(t), from, to))
+			r.resample(b, 0, t, 0, len(t))
+			s[i] = append(s[i], b)
+		}
+	}
+	return s
+}
+
+// beepSounds returns sounds of beeps at the beginning and the end of audio
+// at the given sample rate.
+func beepSounds(rate int) (start, end []int16) {
+	beepsMu.Lock()
+	defer beepsMu.Unlock()
+	b, ok := beeps[rate]
+	if !ok {
+		b[0] = resample(decodePCM8(beepSound), 8000, rate)
+		b[1] = changeSpeed(b[0], 1.4)
+		beeps[rate] = b
+	}
+	return b[0], b[1]
+}
+
+// getVoice returns the voice of the language, or the English one if there
+// is no voice for it.
+func getVoice(lang string) *voice {
+	initVoices()
+	voicesMu.RLock()
+	defer voicesMu.RUnlock()
+	if v, ok := voices[lang]; ok {
+		return v
+	}
+	return voices["en"]
+}
+
+// RegisterVoice registers sounds of digits 0 to 9 pronounced in the given
+// language, replacing the built-in or previously registered voice for it.
+// Sounds are WAVE files with mono PCM data, 8 or 16 bits per sample, at a
+// sample rate from 8000 to 48000 Hz, not longer than 2 seconds. They are
+// resampled when registered, so the rate doesn't have to match the rate of
+// audio captchas.
+//
+// Arithmetic operators can't be pronounced in the language until their
+// sounds are registered with RegisterOperators.
+func RegisterVoice(lang string, digits [10][]byte) error {
+	var takes [10][][]byte
+	for i, b := range digits {
+		takes[i] = [][]byte{b}
+	}
+	sp, err := decodeSpeaker(takes)
+	if err != nil {
+		return err
+	}
+	initVoices()
+	voicesMu.Lock()
+	voices[lang] = &voice{speakers: []*speaker{sp}, rate: sampleRate}
+	voicesMu.Unlock()
+	return nil
+}
+
+// AddSpeaker adds another speaker to the voice of the given language, or
+// registers a new voice if there is none. Each digit from 0 to 9 must have
+// at least one take. Audio captchas use a speaker chosen randomly for each
+// captcha, or for each digit if AudioOptions.MixSpeakers is set, and a
+// random take of each digit, so that the same recording doesn't recur in
+// every captcha. See RegisterVoice for the format of sounds.
+func AddSpeaker(lang string, takes [10][][]byte) error {
+	sp, err := decodeSpeaker(takes)
+	if err != nil {
+		return err
+	}
+	initVoices()
+	voicesMu.Lock()
+	defer voicesMu.Unlock()
+	nv := &voice{rate: sampleRate}
+	if v, ok := voices[lang]; ok {
+		v = v.atRate(sampleRate)
+		nv.speakers, nv.operators = v.speakers, v.operators
+	}
+	nv.speakers = append(nv.speakers[:len(nv.speakers):len(nv.speakers)], sp)
+	voices[lang] = nv
+	return nil
+}
+
+// RegisterOperators registers sounds of arithmetic operators plus, minus,
+// times and equals pronounced in the given language, which must have a
+// voice. See RegisterVoice for the format of sounds.
+func RegisterOperators(lang string, operators [4][]byte) error {
+	ops := make([][][]int16, len(operators))
+	for i, b := range operators {
+		s, err := decodeVoiceSound(b)
+		if err != nil {
+			return fmt.Errorf("captcha: sound of %c: %v", opChars[i], err)
+		}
+		ops[i] = [][]int16{s}
+	}
+	initVoices()
+	voicesMu.Lock()
+	defer voicesMu.Unlock()
+	v, ok := voices[lang]
+	if !ok {
+		return fmt.Errorf("captcha: no voice for language %q", lang)
+	}
+	v = v.atRate(sampleRate)
+	voices[lang] = &voice{speakers: v.speakers, operators: ops, rate: sampleRate}
+	return nil
+}
+
+// decodeSpeaker returns a speaker with the given takes of digits.
+func decodeSpeaker(takes [10][][]byte) (*speaker, error) {
+	sp := &speaker{digits: make([][][]int16, len(takes))}
+	for i, t := range takes {
+		if len(t) == 0 {
+			return nil, fmt.Errorf("captcha: no sound of %d", i)
+		}
+		for _, b := range t {
+			s, err := decodeVoiceSound(b)
+			if err != nil {
+				return nil, fmt.Errorf("captcha: sound of %d: %v", i, err)
+			}
+			sp.digits[i] = append(sp.digits[i], s)
+		}
+	}
+	return sp, nil
+}
+
+// operatorNames are names of files with sounds of arithmetic operators, in
+// order of operator codes.
+var operatorNames = [...]string{"plus", "minus", "times", "equals"}
+
+// RegisterVoiceFS is like RegisterVoice, but reads sounds from WAVE files in
+// the directory dir of fsys, such as embed.FS. Files are named after digits
+// or operators "plus", "minus", "times" and "equals", optionally followed
+// by a dash and the name of a take, for example, "0.wav", "7-b.wav" or
+// "plus.wav". Each subdirectory with sounds of digits is another speaker.
+// Sounds of arithmetic operators are registered if all of them are in dir.
+func RegisterVoiceFS(lang string, fsys fs.FS, dir string) error {
+	v := &voice{rate: sampleRate}
+	takes, ops, err := readVoiceDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	if takes != nil {
+		sp, err := decodeSpeaker(*takes)
+		if err != nil {
+			return err
+		}
+		v.speakers = append(v.speakers, sp)
+	}
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		t, _, err := readVoiceDir(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			continue
+		}
+		sp, err := decodeSpeaker(*t)
+		if err != nil {
+			return fmt.Errorf("%v (speaker %s)", err, e.Name())
+		}
+		v.speakers = append(v.speakers, sp)
+	}
+	if len(v.speakers) == 0 {
+		return errors.New("captcha: no sounds of digits in " + dir)
+	}
+	if ops != nil {
+		v.operators = make([][][]int16, len(ops))
+		for i, t := range ops {
+			for _, b := range t {
+				s, err := decodeVoiceSound(b)
+				if err != nil {
+					return fmt.Errorf("captcha: sound of %c: %v", opChars[i], err)
+				}
+				v.operators[i] = append(v.operators[i], s)
+			}
+		}
+	}
+	initVoices()
+	voicesMu.Lock()
+	voices[lang] = v
+	voicesMu.Unlock()
+	return nil
+}
+
+// readVoiceDir reads takes of digits and operators from WAVE files in the
+// directory. It returns nil takes if there are no sounds of digits, and nil
+// operators if any of them has no sounds.
+func readVoiceDir(fsys fs.FS, dir string) (digits *[10][][]byte, operators [][][]byte, err error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var d [10][][]byte
+	ops := make([][][]byte, len(operatorNames))
+	hasDigits := false
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".wav") {
+			continue
+		}
+		base := strings.TrimSuffix(name, ".wav")
+		if i := strings.IndexByte(base, '-'); i >= 0 {
+			base = base[:i]
+		}
+		var t *[][]byte
+		if len(base) == 1 && '0' <= base[0] && base[0] <= '9' {
+			t = &d[base[0]-'0']
+			hasDigits = true
+		} else {
+			for i, op := range operatorNames {
+				if base == op {
+					t = &ops[i]
+				}
+			}
+		}
+		if t == nil {
+			continue
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		*t = append(*t, b)
+	}
+	if hasDigits {
+		digits = &d
+	}
+	for _, t := range ops {
+		if len(t) == 0 {
+			return digits, nil, nil
+		}
+	}
+	return digits, ops, nil
+}
+
+// decodeVoiceSound returns samples at sampleRate of the WAVE file,
+// checking its format and duration.
+func decodeVoiceSound(b []byte) ([]int16, error) {
+	s, rate, err := decodeWAV(b)
+	if err != nil {
+		return nil, err
+	}
+	// Check duration before resampling, which is slow for long sounds.
+	switch n := resampledLen(len(s), rate, sampleRate); {
+	case n < minVoiceSoundLen:
+		return nil, errors.New("sound is too short")
+	case n > maxVoiceSoundLen:
+		return nil, errors.New("sound is too long")
+	}
+	return resample(s, rate, sampleRate), nil
+}
+
+// decodeWAV returns samples and the sample rate of the WAVE file with mono
+// 8-bit or 16-bit PCM data.
+func decodeWAV(b []byte) (samples []int16, rate int, err error) {
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		return nil, 0, errors.New("not a WAVE file")
+	}
+	var bits int
+	b = b[12:]
+	for len(b) >= 8 {
+		id := string(b[0:4])
+		size := int(binary.LittleEndian.Uint32(b[4:]))
+		b = b[8:]
+		if size < 0 || size > len(b) {
+			return nil, 0, errors.New("truncated WAVE chunk")
+		}
+		chunk := b[:size]
+		b = b[size:]
+		if size%2 != 0 && len(b) > 0 {
+			b = b[1:] // padding
+		}
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, errors.New("bad WAVE format chunk")
+			}
+			format := binary.LittleEndian.Uint16(chunk[0:])
+			channels := binary.LittleEndian.Uint16(chunk[2:])
+			rate = int(binary.LittleEndian.Uint32(chunk[4:]))
+			bits = int(binary.LittleEndian.Uint16(chunk[14:]))
+			switch {
+			case format != 1:
+				return nil, 0, errors.New("WAVE data is not PCM")
+			case channels != 1:
+				return nil, 0, errors.New("WAVE sound is not mono")
+			case bits != 8 && bits != 16:
+				return nil, 0, errors.New("WAVE sound must have 8 or 16 bits per sample")
+			case rate < 8000 || rate > 48000:
+				return nil, 0, errors.New("WAVE sample rate must be in range [8000, 48000]")
+			}
+		case "data":
+			switch bits {
+			case 0:
+				return nil, 0, errors.New("WAVE data before format chunk")
+			case 8:
+				return decodePCM8(chunk), rate, nil
+			default:
+				return decodePCM16(chunk), rate, nil
+			}
+		}
+	}
+	return nil, 0, errors.New("no data in WAVE file")
+}
@@ -0,0 +1,201 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testWAV returns a WAVE file with a sine tone of the given duration.
+func testWAV(seconds float64, rate, bits int) []byte {
+	s := make([]int16, int(seconds*float64(rate)))
+	for i := range s {
+		s[i] = int16(10000 * math.Sin(2*math.Pi*440*float64(i)/float64(rate)))
+	}
+	var data []byte
+	if bits == 8 {
+		data = appendPCM8(nil, s)
+	} else {
+		data = appendPCM16(nil, s)
+	}
+	b := waveHeader(len(data), rate, bits)
+	b = append(b, data...)
+	if len(data)%2 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func TestDecodeWAV(t *testing.T) {
+	for _, f := range []struct{ rate, bits int }{{8000, 8}, {16000, 16}, {44100, 16}, {11025, 8}} {
+		s, rate, err := decodeWAV(testWAV(0.5, f.rate, f.bits))
+		if err != nil {
+			t.Fatalf("%+v: %v", f, err)
+		}
+		if rate != f.rate || len(s) != f.rate/2 {
+			t.Errorf("%+v: decoded %d samples at %d Hz", f, len(s), rate)
+		}
+	}
+	stereo := testWAV(0.5, 8000, 16)
+	stereo[22] = 2
+	bad := [][]byte{
+		nil,
+		[]byte("RIFF\x00\x00\x00\x00WAVE"),
+		testWAV(0.5, 8000, 16)[:50],
+		stereo,
+		testWAV(0.5, 96000, 16),
+	}
+	for i, b := range bad {
+		if _, _, err := decodeWAV(b); err == nil {
+			t.Errorf("%d: expected error", i)
+		}
+	}
+	if _, err := decodeVoiceSound(testWAV(3, 8000, 8)); err == nil {
+		t.Errorf("expected error for long sound")
+	}
+	if _, err := decodeVoiceSound(testWAV(0.01, 8000, 8)); err == nil {
+		t.Errorf("expected error for short sound")
+	}
+	// Duration is checked at the voice sample rate.
+	if s, err := decodeVoiceSound(testWAV(2, 48000, 16)); err != nil || len(s) != maxVoiceSoundLen {
+		t.Errorf("sound of maximum duration: got %d samples, %v", len(s), err)
+	}
+	if _, err := decodeVoiceSound(testWAV(2.01, 48000, 16)); err == nil {
+		t.Errorf("expected error for long sound at high sample rate")
+	}
+}
+
+func TestRegisterVoice(t *testing.T) {
+	defer func() {
+		voicesMu.Lock()
+		delete(voices, "xx")
+		voicesMu.Unlock()
+	}()
+	fsys := make(fstest.MapFS)
+	for i := 0; i < 10; i++ {
+		fsys["xx/"+string(rune('0'+i))+".wav"] = &fstest.MapFile{Data: testWAV(0.4, 16000, 16)}
+	}
+	if err := RegisterVoiceFS("xx", fsys, "xx"); err != nil {
+		t.Fatal(err)
+	}
+	if v := getVoice("xx"); v == getVoice("en") || len(v.speakers) != 1 || v.operators != nil {
+		t.Fatalf("voice is not registered")
+	}
+	if len(getVoice("xx").speakers[0].digits[0][0]) != sampleRate*4/10 {
+		t.Errorf("sound is not resampled")
+	}
+	m := NewManager(Config{Lang: "xx"})
+	if _, err := m.NewWithOptions(context.Background(), Options{Arithmetic: true}); err == nil {
+		t.Errorf("expected error creating challenge without operator sounds")
+	}
+	for _, name := range operatorNames {
+		fsys["xx/"+name+".wav"] = &fstest.MapFile{Data: testWAV(0.3, 8000, 8)}
+	}
+	if err := RegisterVoiceFS("xx", fsys, "xx"); err != nil {
+		t.Fatal(err)
+	}
+	id := m.NewArithmetic()
+	if err := m.WriteAudio(ioutil.Discard, id, ""); err != nil {
+		t.Errorf("WriteAudio: %v", err)
+	}
+
+	var digits [10][]byte
+	for i := range digits {
+		digits[i] = testWAV(0.4, 8000, 8)
+	}
+	digits[7] = testWAV(0.4, 8000, 16)[:30]
+	if err := RegisterVoice("xx", digits); err == nil || !strings.Contains(err.Error(), "sound of 7") {
+		t.Errorf("expected error for bad sound of 7, got %v", err)
+	}
+	if err := RegisterOperators("yy", [4][]byte{}); err == nil {
+		t.Errorf("expected error registering operators without voice")
+	}
+}
+
+func TestVoiceSpeakers(t *testing.T) {
+	defer func() {
+		voicesMu.Lock()
+		delete(voices, "xx")
+		voicesMu.Unlock()
+	}()
+	// Two speakers in subdirectories, the second one with two takes of
+	// each digit, and sounds of operators.
+	fsys := make(fstest.MapFS)
+	for i := 0; i < 10; i++ {
+		d := string(rune('0' + i))
+		fsys["xx/a/"+d+".wav"] = &fstest.MapFile{Data: testWAV(0.2, 8000, 8)}
+		fsys["xx/b/"+d+"-1.wav"] = &fstest.MapFile{Data: testWAV(0.3, 8000, 8)}
+		fsys["xx/b/"+d+"-2.wav"] = &fstest.MapFile{Data: testWAV(0.4, 8000, 8)}
+	}
+	for _, name := range operatorNames {
+		fsys["xx/"+name+".wav"] = &fstest.MapFile{Data: testWAV(0.3, 8000, 8)}
+	}
+	fsys["xx/README"] = &fstest.MapFile{Data: []byte("ignored")}
+	if err := RegisterVoiceFS("xx", fsys, "xx"); err != nil {
+		t.Fatal(err)
+	}
+	v := getVoice("xx")
+	if len(v.speakers) != 2 || len(v.speakers[0].digits[5]) != 1 || len(v.speakers[1].digits[5]) != 2 || len(v.operators) != len(opChars) {
+		t.Fatalf("wrong speakers registered")
+	}
+
+	// Speakers are chosen by the seed.
+	digits := []byte{1, 2, 3, 4, 5, 6}
+	used := make(map[*speaker]bool)
+	for i := 0; i < 20; i++ {
+		a := newAudio([16]byte{byte(i)}, digits, "xx", DefaultAudio)
+		if len(a.speakers) != 1 {
+			t.Fatalf("expected one speaker, got %d", len(a.speakers))
+		}
+		used[a.speakers[0]] = true
+		if b := newAudio([16]byte{byte(i)}, digits, "xx", DefaultAudio); b.speakers[0] != a.speakers[0] || b.length != a.length {
+			t.Fatalf("speaker is not chosen deterministically")
+		}
+	}
+	if len(used) != 2 {
+		t.Errorf("expected both speakers to be used, got %d", len(used))
+	}
+	opts := DefaultAudio
+	opts.MixSpeakers = true
+	if a := newAudio([16]byte{1}, digits, "xx", opts); len(a.speakers) != 2 {
+		t.Errorf("expected mixed speakers, got %d", len(a.speakers))
+	}
+
+	// Added speakers keep existing ones.
+	var takes [10][][]byte
+	for i := range takes {
+		takes[i] = [][]byte{testWAV(0.2, 16000, 16)}
+	}
+	if err := AddSpeaker("xx", takes); err != nil {
+		t.Fatal(err)
+	}
+	if nv := getVoice("xx"); len(nv.speakers) != 3 || len(v.speakers) != 2 || nv.operators == nil {
+		t.Errorf("speaker is not added")
+	}
+	takes[3] = nil
+	if err := AddSpeaker("xx", takes); err == nil {
+		t.Errorf("expected error for speaker without sounds of 3")
+	}
+}
+
+func TestVoiceAtRate(t *testing.T) {
+	v := getVoice("en")
+	// Built-in sounds are used at their own rate without resampling.
+	if v.atRate(8000) != v {
+		t.Errorf("built-in voice is resampled to its own rate")
+	}
+	w := v.atRate(16000)
+	if w != v.atRate(16000) {
+		t.Errorf("resampled voice is not cached")
+	}
+	if n, m := len(v.speakers[0].digits[3][0]), len(w.speakers[0].digits[3][0]); m != 2*n {
+		t.Errorf("resampled sound has %d samples, expected %d", m, 2*n)
+	}
+}
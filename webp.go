@@ -0,0 +1,407 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+// This file implements a simple encoder of lossless WebP (VP8L) images.
+//
+// It doesn't use transforms or color cache. Pixels are coded with a single
+// group of prefix codes built from their histograms, and runs of pixels
+// equal to the previous pixel or to the pixel above are coded as backward
+// references, which is enough to compress captcha images, most of which is
+// transparent background.
+
+const (
+	vp8lSignature   = 0x2f
+	vp8lNumLiterals = 256
+	vp8lNumLengths  = 24
+	vp8lNumDistance = 40
+	vp8lMaxLength   = 4096
+	// Distance codes of the pixel above and the previous pixel.
+	vp8lDistanceUp   = 1
+	vp8lDistanceLeft = 2
+	// Maximum length of prefix codes and of code length codes.
+	vp8lMaxCodeLength   = 15
+	vp8lMaxCLCodeLength = 7
+)
+
+// Order of code lengths of code length codes.
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// WriteWebP writes captcha image in lossless WebP format into the given
+// writer.
+func (m *Image) WriteWebP(w io.Writer) error {
+	return encodeWebP(w, m.Paletted)
+}
+
+// bitWriter writes bits starting from the least significant ones.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (b *bitWriter) writeBits(v uint32, n uint) {
+	b.acc |= uint64(v) << b.nbits
+	b.nbits += n
+	for b.nbits >= 8 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc >>= 8
+		b.nbits -= 8
+	}
+}
+
+func (b *bitWriter) flush() []byte {
+	if b.nbits > 0 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc, b.nbits = 0, 0
+	}
+	return b.buf
+}
+
+// prefixCode is a canonical Huffman code.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32 // bit-reversed, ready to be written
+}
+
+func (c *prefixCode) write(b *bitWriter, sym int) {
+	b.writeBits(c.codes[sym], uint(c.lengths[sym]))
+}
+
+// newPrefixCode returns a canonical Huffman code for the given histogram,
+// with code lengths limited to maxLength.
+func newPrefixCode(hist []int, maxLength int) *prefixCode {
+	counts := append([]int(nil), hist...)
+	used := 0
+	for _, n := range counts {
+		if n > 0 {
+			used++
+		}
+	}
+	// Codes must be complete trees, which needs at least two symbols.
+	for i := 0; used < 2; i++ {
+		if counts[i] == 0 {
+			counts[i] = 1
+			used++
+		}
+	}
+	var lengths []uint8
+	for {
+		lengths = huffmanLengths(counts)
+		max := uint8(0)
+		for _, l := range lengths {
+			if l > max {
+				max = l
+			}
+		}
+		if int(max) <= maxLength {
+			break
+		}
+		// Flatten the histogram until the code fits.
+		for i, n := range counts {
+			if n > 0 {
+				counts[i] = (n + 1) / 2
+			}
+		}
+	}
+	c := &prefixCode{lengths: lengths, codes: make([]uint32, len(lengths))}
+	// Assign canonical codes.
+	var count [vp8lMaxCodeLength + 1]uint32
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [vp8lMaxCodeLength + 2]uint32
+	code := uint32(0)
+	for l := 1; l <= vp8lMaxCodeLength; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for sym, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c.codes[sym] = reverseBits(next[l], uint(l))
+		next[l]++
+	}
+	return c
+}
+
+func reverseBits(v uint32, n uint) uint32 {
+	r := uint32(0)
+	for i := uint(0); i < n; i++ {
+		r = r<<1 | v&1
+		v >>= 1
+	}
+	return r
+}
+
+type huffmanNode struct {
+	count       int
+	sym         int // -1 for internal nodes
+	left, right *huffmanNode
+}
+
+type huffmanHeap []*huffmanNode
+
+func (h huffmanHeap) Len() int { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].sym < h[j].sym
+}
+func (h huffmanHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x interface{}) { *h = append(*h, x.(*huffmanNode)) }
+func (h *huffmanHeap) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// huffmanLengths returns Huffman code lengths for the given counts. There
+// must be at least two symbols with non-zero counts.
+func huffmanLengths(counts []int) []uint8 {
+	h := make(huffmanHeap, 0, len(counts))
+	for sym, n := range counts {
+		if n > 0 {
+			h = append(h, &huffmanNode{count: n, sym: sym})
+		}
+	}
+	heap.Init(&h)
+	for h.Len() > 1 {
+		a := heap.Pop(&h).(*huffmanNode)
+		b := heap.Pop(&h).(*huffmanNode)
+		heap.Push(&h, &huffmanNode{count: a.count + b.count, sym: -1, left: a, right: b})
+	}
+	lengths := make([]uint8, len(counts))
+	var walk func(n *huffmanNode, depth uint8)
+	walk = func(n *huffmanNode, depth uint8) {
+		if n.sym >= 0 {
+			lengths[n.sym] = depth
+			return
+		}
+		walk(n.left, depth+1)
+		walk(n.right, depth+1)
+	}
+	walk(h[0], 0)
+	return lengths
+}
+
+// writeCode writes the prefix code.
+func (c *prefixCode) writeCode(b *bitWriter) {
+	// Use simple code for codes with two symbols that fit in 8 bits.
+	var syms []int
+	for sym, l := range c.lengths {
+		if l > 0 {
+			syms = append(syms, sym)
+		}
+	}
+	if len(syms) == 2 && syms[1] < 256 {
+		b.writeBits(1, 1) // simple code
+		b.writeBits(1, 1) // two symbols
+		b.writeBits(1, 1) // first symbol is 8 bits
+		b.writeBits(uint32(syms[0]), 8)
+		b.writeBits(uint32(syms[1]), 8)
+		return
+	}
+	b.writeBits(0, 1) // normal code
+	// Encode code lengths with code length codes: literal lengths and runs
+	// of zeros.
+	type token struct{ sym, extra, nextra int }
+	var tokens []token
+	for i := 0; i < len(c.lengths); {
+		if c.lengths[i] != 0 {
+			tokens = append(tokens, token{int(c.lengths[i]), 0, 0})
+			i++
+			continue
+		}
+		run := 0
+		for i+run < len(c.lengths) && c.lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+		switch {
+		case run >= 11:
+			tokens = append(tokens, token{18, run - 11, 7})
+		case run >= 3:
+			tokens = append(tokens, token{17, run - 3, 3})
+		default:
+			for j := 0; j < run; j++ {
+				tokens = append(tokens, token{0, 0, 0})
+			}
+		}
+		i += run
+	}
+	hist := make([]int, len(vp8lCodeLengthOrder))
+	for _, t := range tokens {
+		hist[t.sym]++
+	}
+	cl := newPrefixCode(hist, vp8lMaxCLCodeLength)
+	n := len(vp8lCodeLengthOrder)
+	for n > 4 && cl.lengths[vp8lCodeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	b.writeBits(uint32(n-4), 4)
+	for _, sym := range vp8lCodeLengthOrder[:n] {
+		b.writeBits(uint32(cl.lengths[sym]), 3)
+	}
+	b.writeBits(0, 1) // max_symbol is the alphabet size
+	for _, t := range tokens {
+		cl.write(b, t.sym)
+		if t.nextra > 0 {
+			b.writeBits(uint32(t.extra), uint(t.nextra))
+		}
+	}
+}
+
+// prefixEncode returns prefix symbol, number of extra bits and their value
+// for the given length or distance code.
+func prefixEncode(v int) (sym, nextra, extra int) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	h := 0
+	for d>>uint(h+1) != 0 {
+		h++
+	}
+	second := d >> uint(h-1) & 1
+	nextra = h - 1
+	return 2*h + second, nextra, d & (1<<uint(nextra) - 1)
+}
+
+// vp8lSymbol is a literal pixel or a backward reference.
+type vp8lSymbol struct {
+	argb   uint32
+	length int // zero for literals
+	dist   int // distance code
+}
+
+// encodeWebP writes the paletted image in lossless WebP format.
+func encodeWebP(w io.Writer, p *image.Paletted) error {
+	width, height := p.Rect.Dx(), p.Rect.Dy()
+	if width < 1 || height < 1 || width > 1<<14 || height > 1<<14 {
+		return errors.New("captcha: bad image size for WebP")
+	}
+	palette := make([]uint32, len(p.Palette))
+	for i, c := range p.Palette {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		palette[i] = uint32(n.A)<<24 | uint32(n.R)<<16 | uint32(n.G)<<8 | uint32(n.B)
+	}
+	pixels := make([]uint32, 0, width*height)
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		for x := p.Rect.Min.X; x < p.Rect.Max.X; x++ {
+			pixels = append(pixels, palette[p.ColorIndexAt(x, y)])
+		}
+	}
+
+	// Find runs of pixels equal to the previous one or the one above.
+	var symbols []vp8lSymbol
+	for i := 0; i < len(pixels); {
+		left, up := 0, 0
+		if i > 0 {
+			for i+left < len(pixels) && left < vp8lMaxLength && pixels[i+left] == pixels[i+left-1] {
+				left++
+			}
+		}
+		if i >= width {
+			for i+up < len(pixels) && up < vp8lMaxLength && pixels[i+up] == pixels[i+up-width] {
+				up++
+			}
+		}
+		switch {
+		case left >= 3 && left >= up:
+			symbols = append(symbols, vp8lSymbol{length: left, dist: vp8lDistanceLeft})
+			i += left
+		case up >= 3:
+			symbols = append(symbols, vp8lSymbol{length: up, dist: vp8lDistanceUp})
+			i += up
+		default:
+			symbols = append(symbols, vp8lSymbol{argb: pixels[i]})
+			i++
+		}
+	}
+
+	// Build prefix codes: green and lengths, red, blue, alpha, distance.
+	hists := [5][]int{
+		make([]int, vp8lNumLiterals+vp8lNumLengths),
+		make([]int, vp8lNumLiterals),
+		make([]int, vp8lNumLiterals),
+		make([]int, vp8lNumLiterals),
+		make([]int, vp8lNumDistance),
+	}
+	for _, s := range symbols {
+		if s.length == 0 {
+			hists[0][s.argb>>8&0xff]++
+			hists[1][s.argb>>16&0xff]++
+			hists[2][s.argb&0xff]++
+			hists[3][s.argb>>24]++
+			continue
+		}
+		sym, _, _ := prefixEncode(s.length)
+		hists[0][vp8lNumLiterals+sym]++
+		sym, _, _ = prefixEncode(s.dist)
+		hists[4][sym]++
+	}
+	var codes [5]*prefixCode
+	for i, h := range hists {
+		codes[i] = newPrefixCode(h, vp8lMaxCodeLength)
+	}
+
+	var b bitWriter
+	b.writeBits(vp8lSignature, 8)
+	b.writeBits(uint32(width-1), 14)
+	b.writeBits(uint32(height-1), 14)
+	b.writeBits(1, 1) // alpha is used
+	b.writeBits(0, 3) // version
+	b.writeBits(0, 1) // no transforms
+	b.writeBits(0, 1) // no color cache
+	b.writeBits(0, 1) // single group of prefix codes
+	for _, c := range codes {
+		c.writeCode(&b)
+	}
+	for _, s := range symbols {
+		if s.length == 0 {
+			codes[0].write(&b, int(s.argb>>8&0xff))
+			codes[1].write(&b, int(s.argb>>16&0xff))
+			codes[2].write(&b, int(s.argb&0xff))
+			codes[3].write(&b, int(s.argb>>24))
+			continue
+		}
+		sym, nextra, extra := prefixEncode(s.length)
+		codes[0].write(&b, vp8lNumLiterals+sym)
+		b.writeBits(uint32(extra), uint(nextra))
+		sym, nextra, extra = prefixEncode(s.dist)
+		codes[4].write(&b, sym)
+		b.writeBits(uint32(extra), uint(nextra))
+	}
+	data := b.flush()
+
+	// Write RIFF container.
+	var buf bytes.Buffer
+	chunkLen := len(data)
+	padded := chunkLen + chunkLen&1
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+8+padded))
+	buf.WriteString("WEBPVP8L")
+	binary.Write(&buf, binary.LittleEndian, uint32(chunkLen))
+	buf.Write(data)
+	if padded != chunkLen {
+		buf.WriteByte(0)
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
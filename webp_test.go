@@ -0,0 +1,233 @@
+// Copyright 2026 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package captcha
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"testing"
+)
+
+// bitReader and decodeVP8L implement a decoder of the subset of lossless
+// WebP produced by encodeWebP.
+type bitReader struct {
+	data []byte
+	pos  uint
+}
+
+func (b *bitReader) readBits(n uint) uint32 {
+	v := uint32(0)
+	for i := uint(0); i < n; i++ {
+		byteIdx := b.pos >> 3
+		if int(byteIdx) < len(b.data) {
+			v |= uint32(b.data[byteIdx]>>(b.pos&7)&1) << i
+		}
+		b.pos++
+	}
+	return v
+}
+
+type testCode struct {
+	lengths []uint8
+}
+
+// readSymbol decodes a symbol by reading bits one by one and searching
+// canonical codes.
+func (c *testCode) readSymbol(b *bitReader) int {
+	used := 0
+	for _, l := range c.lengths {
+		if l > 0 {
+			used++
+		}
+	}
+	if used == 1 {
+		for sym, l := range c.lengths {
+			if l > 0 {
+				return sym
+			}
+		}
+	}
+	code, first := 0, 0
+	for l := uint8(1); l <= vp8lMaxCodeLength; l++ {
+		code |= int(b.readBits(1))
+		var syms []int
+		for sym, n := range c.lengths {
+			if n == l {
+				syms = append(syms, sym)
+			}
+		}
+		if code-first < len(syms) {
+			return syms[code-first]
+		}
+		first = (first + len(syms)) << 1
+		code <<= 1
+	}
+	return -1
+}
+
+func readTestCode(b *bitReader, size int) *testCode {
+	c := &testCode{lengths: make([]uint8, size)}
+	if b.readBits(1) == 1 {
+		n := b.readBits(1) + 1
+		first := b.readBits(1)*7 + 1
+		c.lengths[b.readBits(uint(first))] = 1
+		if n == 2 {
+			c.lengths[b.readBits(8)] = 1
+		}
+		return c
+	}
+	cl := &testCode{lengths: make([]uint8, 19)}
+	n := int(b.readBits(4)) + 4
+	for _, sym := range vp8lCodeLengthOrder[:n] {
+		cl.lengths[sym] = uint8(b.readBits(3))
+	}
+	if b.readBits(1) != 0 {
+		panic("max_symbol is not supported")
+	}
+	prev := uint8(8)
+	for i := 0; i < size; {
+		sym := cl.readSymbol(b)
+		switch {
+		case sym < 16:
+			c.lengths[i] = uint8(sym)
+			if sym != 0 {
+				prev = uint8(sym)
+			}
+			i++
+		case sym == 16:
+			for n := 3 + int(b.readBits(2)); n > 0; n-- {
+				c.lengths[i] = prev
+				i++
+			}
+		case sym == 17:
+			i += 3 + int(b.readBits(3))
+		case sym == 18:
+			i += 11 + int(b.readBits(7))
+		}
+	}
+	return c
+}
+
+func readPrefixValue(b *bitReader, sym int) int {
+	if sym < 4 {
+		return sym + 1
+	}
+	extra := uint(sym-2) >> 1
+	offset := (2 + sym&1) << extra
+	return offset + int(b.readBits(extra)) + 1
+}
+
+func decodeVP8L(data []byte) (width, height int, pixels []uint32, err error) {
+	if len(data) < 20 || string(data[:4]) != "RIFF" || string(data[8:16]) != "WEBPVP8L" {
+		return 0, 0, nil, errors.New("bad header")
+	}
+	if int(binary.LittleEndian.Uint32(data[4:])) != len(data)-8 {
+		return 0, 0, nil, errors.New("bad RIFF size")
+	}
+	n := int(binary.LittleEndian.Uint32(data[16:]))
+	if n > len(data)-20 {
+		return 0, 0, nil, errors.New("bad chunk size")
+	}
+	b := &bitReader{data: data[20 : 20+n]}
+	if b.readBits(8) != vp8lSignature {
+		return 0, 0, nil, errors.New("bad signature")
+	}
+	width = int(b.readBits(14)) + 1
+	height = int(b.readBits(14)) + 1
+	b.readBits(1)
+	if b.readBits(3) != 0 || b.readBits(1) != 0 || b.readBits(1) != 0 || b.readBits(1) != 0 {
+		return 0, 0, nil, errors.New("unsupported features")
+	}
+	sizes := []int{vp8lNumLiterals + vp8lNumLengths, vp8lNumLiterals, vp8lNumLiterals, vp8lNumLiterals, vp8lNumDistance}
+	codes := make([]*testCode, len(sizes))
+	for i, size := range sizes {
+		codes[i] = readTestCode(b, size)
+	}
+	for len(pixels) < width*height {
+		g := codes[0].readSymbol(b)
+		if g < 0 {
+			return 0, 0, nil, errors.New("bad symbol")
+		}
+		if g < vp8lNumLiterals {
+			r, bl, a := codes[1].readSymbol(b), codes[2].readSymbol(b), codes[3].readSymbol(b)
+			pixels = append(pixels, uint32(a)<<24|uint32(r)<<16|uint32(g)<<8|uint32(bl))
+			continue
+		}
+		length := readPrefixValue(b, g-vp8lNumLiterals)
+		dist := readPrefixValue(b, codes[4].readSymbol(b))
+		switch dist {
+		case vp8lDistanceUp:
+			dist = width
+		case vp8lDistanceLeft:
+			dist = 1
+		default:
+			return 0, 0, nil, errors.New("unsupported distance")
+		}
+		if dist > len(pixels) || len(pixels)+length > width*height {
+			return 0, 0, nil, errors.New("bad backward reference")
+		}
+		for i := 0; i < length; i++ {
+			pixels = append(pixels, pixels[len(pixels)-dist])
+		}
+	}
+	return width, height, pixels, nil
+}
+
+func TestWriteWebP(t *testing.T) {
+	for _, size := range [][2]int{{StdWidth, StdHeight}, {97, 33}} {
+		img := NewImage("id", RandomDigits(6), size[0], size[1])
+		var buf bytes.Buffer
+		if err := img.WriteWebP(&buf); err != nil {
+			t.Fatal(err)
+		}
+		width, height, pixels, err := decodeVP8L(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if width != size[0] || height != size[1] {
+			t.Fatalf("expected %dx%d image, got %dx%d", size[0], size[1], width, height)
+		}
+		for i, p := range pixels {
+			c := color.NRGBAModel.Convert(img.At(i%width, i/width)).(color.NRGBA)
+			if p != uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B) {
+				t.Fatalf("wrong pixel %d: %08x", i, p)
+			}
+		}
+	}
+}
+
+func TestPrefixEncode(t *testing.T) {
+	for v := 1; v <= vp8lMaxLength; v++ {
+		sym, nextra, extra := prefixEncode(v)
+		b := &bitWriter{}
+		b.writeBits(uint32(extra), uint(nextra))
+		if got := readPrefixValue(&bitReader{data: b.flush()}, sym); got != v {
+			t.Fatalf("%d encoded as %d", v, got)
+		}
+	}
+}
+
+func TestPrefixCodeLengths(t *testing.T) {
+	hist := make([]int, 280)
+	for i := range hist {
+		hist[i] = 1 << uint(i%30)
+	}
+	c := newPrefixCode(hist, vp8lMaxCodeLength)
+	// Code must be a complete tree.
+	sum := 0
+	for _, l := range c.lengths {
+		if l > vp8lMaxCodeLength {
+			t.Fatalf("code length %d exceeds limit", l)
+		}
+		if l > 0 {
+			sum += 1 << (vp8lMaxCodeLength - l)
+		}
+	}
+	if sum != 1<<vp8lMaxCodeLength {
+		t.Errorf("incomplete code")
+	}
+}